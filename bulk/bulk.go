@@ -2,6 +2,7 @@ package bulk
 
 import (
 	"bytes"
+	"io"
 	"io/fs"
 	"os"
 
@@ -38,7 +39,8 @@ func (f *SliceFile) Close() error {
 // Tagger is object to get access to package nested files
 // by reading sections of bytes slice.
 type Tagger struct {
-	bulk []byte // slice with whole package content
+	bulk []byte       // slice with whole package content
+	unp  wpk.Unpacker // decrypts and unpacks files data
 }
 
 // MakeTagger creates Tagger object to get access to package nested files.
@@ -51,9 +53,34 @@ func MakeTagger(fpath string) (wpk.Tagger, error) {
 	return &tgr, nil
 }
 
+// MakeTaggerAt creates Tagger object to get access to package nested files
+// placed at random-access source with given size. Source content is read
+// into memory at once.
+func MakeTaggerAt(r io.ReaderAt, size int64) (wpk.Tagger, error) {
+	var tgr Tagger
+	tgr.bulk = make([]byte, size)
+	var n, err = r.ReadAt(tgr.bulk, 0)
+	if n < len(tgr.bulk) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return &tgr, nil
+}
+
+// SetKey sets the key to decrypt files encrypted by AES-GCM.
+// wpk.KeySetter implementation.
+func (tgr *Tagger) SetKey(key []byte) error {
+	return tgr.unp.SetKey(key)
+}
+
 // OpenTagset creates file object to give access to nested into package file by given tagset.
+// Compressed file is unpacked at once, encrypted file is decrypted by chunks on demand.
 func (tgr *Tagger) OpenTagset(ts wpk.TagsetRaw) (wpk.RFile, error) {
-	return NewSliceFile(tgr.bulk, ts)
+	return tgr.unp.Open(ts, func() (wpk.RFile, error) {
+		return NewSliceFile(tgr.bulk, ts)
+	})
 }
 
 // Close does nothing, there is no any opened handles.
@@ -0,0 +1,141 @@
+package wpk
+
+import (
+	"container/list"
+	"io"
+	"sync"
+)
+
+// cacheKey identifies file content by its data placement.
+type cacheKey struct {
+	offset, size uint
+	blkoff       uint // offset of file in solid block, or 0
+}
+
+// cacheItem is cached file content.
+type cacheItem struct {
+	key  cacheKey
+	data []byte
+}
+
+// CacheStat is statistics of CacheTagger.
+type CacheStat struct {
+	Hits      int64 // number of files opened from cache
+	Misses    int64 // number of files opened by nested tagger
+	Evictions int64 // number of contents removed from cache to free the space
+	Count     int   // number of cached contents
+	Size      int64 // total size of cached contents
+}
+
+// CacheTagger is Tagger decorator that keeps content of recently opened files
+// in memory. Cache is bounded by total size of contents, and least recently
+// used contents are evicted first. Contents are identified by data offset
+// and size of tagset, so aliases share the same cached content. Files with
+// size greater than the limit are opened by nested tagger without caching.
+type CacheTagger struct {
+	Tagger
+	limit int64
+	size  int64
+	lru   *list.List // front - most recently used
+	items map[cacheKey]*list.Element
+	stat  CacheStat
+	mux   sync.Mutex
+}
+
+// NewCacheTagger returns CacheTagger that caches files opened by given
+// tagger, with total size of cached contents up to limit bytes.
+func NewCacheTagger(tgr Tagger, limit int64) *CacheTagger {
+	return &CacheTagger{
+		Tagger: tgr,
+		limit:  limit,
+		lru:    list.New(),
+		items:  map[cacheKey]*list.Element{},
+	}
+}
+
+// get returns cached content and moves it to front of the list.
+func (ct *CacheTagger) get(key cacheKey) (data []byte, ok bool) {
+	ct.mux.Lock()
+	defer ct.mux.Unlock()
+	var el *list.Element
+	if el, ok = ct.items[key]; ok {
+		ct.lru.MoveToFront(el)
+		data = el.Value.(*cacheItem).data
+		ct.stat.Hits++
+	} else {
+		ct.stat.Misses++
+	}
+	return
+}
+
+// put places content into cache, and evicts least recently
+// used contents to keep total size in the limit.
+func (ct *CacheTagger) put(key cacheKey, data []byte) {
+	ct.mux.Lock()
+	defer ct.mux.Unlock()
+	if _, ok := ct.items[key]; ok {
+		return // was placed by concurrent call
+	}
+	ct.items[key] = ct.lru.PushFront(&cacheItem{key: key, data: data})
+	ct.size += int64(len(data))
+	for ct.size > ct.limit {
+		var item = ct.lru.Remove(ct.lru.Back()).(*cacheItem)
+		delete(ct.items, item.key)
+		ct.size -= int64(len(item.data))
+		ct.stat.Evictions++
+	}
+}
+
+// OpenTagset returns file with cached content, or opens file by nested
+// tagger and places its content into cache.
+// Tagger interface implementation.
+func (ct *CacheTagger) OpenTagset(ts TagsetRaw) (RFile, error) {
+	var offset, size = ts.Pos()
+	var blkoff, _ = ts.TagUint(TIDblkoff)
+	var key = cacheKey{offset, size, blkoff}
+	if data, ok := ct.get(key); ok {
+		return NewMemFile(data, ts), nil
+	}
+
+	var f, err = ct.Tagger.OpenTagset(ts)
+	if err != nil {
+		return nil, err
+	}
+	if ts.Size() > ct.limit {
+		return f, nil
+	}
+	defer f.Close()
+	var data = make([]byte, ts.Size())
+	if _, err = io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	ct.put(key, data)
+	return NewMemFile(data, ts), nil
+}
+
+// CacheStat returns statistics of cache usage.
+func (ct *CacheTagger) CacheStat() CacheStat {
+	ct.mux.Lock()
+	defer ct.mux.Unlock()
+	var stat = ct.stat
+	stat.Count, stat.Size = len(ct.items), ct.size
+	return stat
+}
+
+// Purge removes all contents from cache.
+func (ct *CacheTagger) Purge() {
+	ct.mux.Lock()
+	defer ct.mux.Unlock()
+	ct.lru.Init()
+	ct.items = map[cacheKey]*list.Element{}
+	ct.size = 0
+}
+
+// Close removes all contents from cache, and closes nested tagger.
+// io.Closer implementation.
+func (ct *CacheTagger) Close() error {
+	ct.Purge()
+	return ct.Tagger.Close()
+}
+
+// The End.
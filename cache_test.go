@@ -0,0 +1,75 @@
+package wpk_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/fsys"
+)
+
+// Test files caching by CacheTagger with LRU eviction.
+func TestCacheTagger(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+
+	var files = map[string]string{}
+	for i := 0; i < 4; i++ {
+		files[fmt.Sprintf("file%d.txt", i)] = strings.Repeat(fmt.Sprint(i), 100)
+	}
+	files["big.txt"] = strings.Repeat("big", 100)
+	var pkg = packmap(t, testpack1, files)
+	pkg.Close()
+
+	var tgr wpk.Tagger
+	if tgr, err = fsys.MakeTagger(testpack1); err != nil {
+		t.Fatal(err)
+	}
+	var ct = wpk.NewCacheTagger(tgr, 250) // place for 2 files
+	pkg.Tagger = ct
+	defer pkg.Close()
+
+	var read = func(fkey string) {
+		var b, err = pkg.ReadFile(fkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != files[fkey] {
+			t.Fatalf("wrong content of file '%s'", fkey)
+		}
+	}
+	var check = func(hits, misses, evictions int64, count int) {
+		var stat = ct.CacheStat()
+		if stat.Hits != hits || stat.Misses != misses || stat.Evictions != evictions || stat.Count != count {
+			t.Fatalf("cache statistics %+v, expected hits %d, misses %d, evictions %d, count %d",
+				stat, hits, misses, evictions, count)
+		}
+	}
+
+	read("file0.txt")
+	read("file1.txt")
+	read("file0.txt")
+	check(1, 2, 0, 2)
+	read("file2.txt") // evicts file1.txt
+	check(1, 3, 1, 2)
+	read("file0.txt")
+	check(2, 3, 1, 2)
+	read("file1.txt") // evicts file2.txt
+	check(2, 4, 2, 2)
+
+	// file greater than limit is not cached
+	read("big.txt")
+	read("big.txt")
+	check(2, 6, 2, 2)
+	if stat := ct.CacheStat(); stat.Size != 200 {
+		t.Fatalf("cached size is %d, expected 200", stat.Size)
+	}
+
+	ct.Purge()
+	read("file0.txt")
+	check(2, 7, 2, 1)
+}
+
+// The End.
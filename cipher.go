@@ -0,0 +1,307 @@
+package wpk
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// Cipher algorithms identifiers, stored at TIDcipher tag.
+const (
+	CipherNone   byte = 0 // data is not encrypted
+	CipherAESGCM byte = 1 // AES-GCM with data divided into chunks
+)
+
+// CipherChunk is size of plain data chunk encrypted as a whole.
+// Each chunk can be decrypted independently, so it gives random access
+// to encrypted file.
+const CipherChunk = 64 * 1024
+
+// Size of authentication tag added to each chunk by AES-GCM.
+const cipheroverhead = 16
+
+// Errors on encrypted files access.
+var (
+	ErrCipherAlg = errors.New("cipher algorithm is not supported")
+	ErrNoKey     = errors.New("file is encrypted, and key is not given")
+	ErrBadNonce  = errors.New("nonce has wrong size")
+	ErrNoDecrypt = errors.New("tagger can not decrypt files")
+)
+
+// KeySetter is implemented by taggers that can decrypt files
+// encrypted by AES-GCM with given key.
+type KeySetter interface {
+	SetKey(key []byte) error
+}
+
+// NewAEAD creates AES-GCM cipher for given key, that should be
+// 16, 24 or 32 bytes length to select AES-128, AES-192 or AES-256.
+func NewAEAD(key []byte) (cipher.AEAD, error) {
+	var block, err = aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SetCipher sets key to encrypt new packing files by AES-GCM.
+// Nil key turns off encryption.
+func (ftt *FTT) SetCipher(key []byte) (err error) {
+	var aead cipher.AEAD
+	if key != nil {
+		if aead, err = NewAEAD(key); err != nil {
+			return
+		}
+	}
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	ftt.aead = aead
+	return
+}
+
+// MakeCipherTagger creates tagger for package file with given path by given
+// function, and sets to it the key to decrypt files encrypted by AES-GCM.
+// Tagger should implement KeySetter interface.
+func MakeCipherTagger(maketagger func(string) (Tagger, error), fpath string, key []byte) (Tagger, error) {
+	var tgr, err = maketagger(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var ks, ok = tgr.(KeySetter)
+	if !ok {
+		tgr.Close()
+		return nil, &fs.PathError{Op: "setkey", Path: fpath, Err: ErrNoDecrypt}
+	}
+	if err = ks.SetKey(key); err != nil {
+		tgr.Close()
+		return nil, err
+	}
+	return tgr, nil
+}
+
+// chunknonce makes nonce for chunk with given index based on file nonce.
+func chunknonce(dst, nonce []byte, idx uint64) []byte {
+	dst = append(dst[:0], nonce...)
+	var n = len(dst)
+	binary.BigEndian.PutUint64(dst[n-8:], binary.BigEndian.Uint64(dst[n-8:])^idx)
+	return dst
+}
+
+// Additional data for chunks, marks the last chunk
+// to prevent truncation of encrypted file.
+var (
+	aadnext = []byte{0}
+	aadlast = []byte{1}
+)
+
+// SealWriter encrypts data written through it by chunks,
+// and writes sealed chunks to underlying writer.
+type SealWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce []byte // file nonce
+	buf   []byte // plain data of current chunk
+	out   []byte // sealed chunk
+	cn    []byte // current chunk nonce
+	idx   uint64 // current chunk index
+}
+
+// NewSealWriter creates SealWriter with new random nonce.
+func NewSealWriter(w io.Writer, aead cipher.AEAD) (sw *SealWriter, err error) {
+	var nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	sw = &SealWriter{
+		w:     w,
+		aead:  aead,
+		nonce: nonce,
+		buf:   make([]byte, 0, CipherChunk),
+	}
+	return
+}
+
+// Nonce returns file nonce that should be stored at TIDnonce tag.
+func (sw *SealWriter) Nonce() []byte {
+	return sw.nonce
+}
+
+func (sw *SealWriter) seal(aad []byte) (err error) {
+	sw.cn = chunknonce(sw.cn, sw.nonce, sw.idx)
+	sw.out = sw.aead.Seal(sw.out[:0], sw.cn, sw.buf, aad)
+	if _, err = sw.w.Write(sw.out); err != nil {
+		return
+	}
+	sw.buf = sw.buf[:0]
+	sw.idx++
+	return
+}
+
+// Write is io.Writer implementation.
+func (sw *SealWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		// full chunk is sealed only when it's known that it's not the last
+		if len(sw.buf) == CipherChunk {
+			if err = sw.seal(aadnext); err != nil {
+				return
+			}
+		}
+		var c = copy(sw.buf[len(sw.buf):CipherChunk], p)
+		sw.buf = sw.buf[:len(sw.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return
+}
+
+// Close seals the last chunk. It does not close underlying writer.
+func (sw *SealWriter) Close() error {
+	if len(sw.buf) == 0 { // empty file has no chunks
+		return nil
+	}
+	return sw.seal(aadlast)
+}
+
+// PlainSize returns size of plain data encrypted into data with given size.
+func PlainSize(size int64, overhead int) int64 {
+	var n = (size + CipherChunk + int64(overhead) - 1) / (CipherChunk + int64(overhead))
+	return size - n*int64(overhead)
+}
+
+// OpenReaderAt decrypts chunks of data given by underlying ReaderAt.
+// io.ReaderAt implementation.
+type OpenReaderAt struct {
+	r     io.ReaderAt
+	aead  cipher.AEAD
+	nonce []byte
+	size  int64 // plain data size
+	last  int64 // index of the last chunk
+
+	idx int64  // index of decrypted chunk at cache
+	buf []byte // decrypted chunk
+	raw []byte // sealed chunk
+	cn  []byte // chunk nonce
+	mux sync.Mutex
+}
+
+// NewOpenReaderAt creates OpenReaderAt for sealed data with given size.
+func NewOpenReaderAt(r io.ReaderAt, aead cipher.AEAD, nonce []byte, size int64) (*OpenReaderAt, error) {
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrBadNonce
+	}
+	var psize = PlainSize(size, aead.Overhead())
+	return &OpenReaderAt{
+		r:     r,
+		aead:  aead,
+		nonce: nonce,
+		size:  psize,
+		last:  (psize+CipherChunk-1)/CipherChunk - 1,
+		idx:   -1,
+	}, nil
+}
+
+// Size returns size of plain data.
+func (ora *OpenReaderAt) Size() int64 {
+	return ora.size
+}
+
+// chunk decrypts chunk with given index. Mutex should be locked by caller.
+func (ora *OpenReaderAt) chunk(idx int64) (err error) {
+	if idx == ora.idx {
+		return
+	}
+	var overhead = int64(ora.aead.Overhead())
+	var plen = int64(CipherChunk)
+	if idx == ora.last {
+		plen = ora.size - idx*CipherChunk
+	}
+	if cap(ora.raw) < int(plen+overhead) {
+		ora.raw = make([]byte, plen+overhead)
+	}
+	ora.raw = ora.raw[:plen+overhead]
+	if _, err = ora.r.ReadAt(ora.raw, idx*(CipherChunk+overhead)); err != nil && err != io.EOF {
+		return
+	}
+	var aad = aadnext
+	if idx == ora.last {
+		aad = aadlast
+	}
+	ora.cn = chunknonce(ora.cn, ora.nonce, uint64(idx))
+	if ora.buf, err = ora.aead.Open(ora.buf[:0], ora.cn, ora.raw, aad); err != nil {
+		ora.idx = -1
+		return
+	}
+	ora.idx = idx
+	return
+}
+
+// ReadAt is io.ReaderAt implementation.
+func (ora *OpenReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fs.ErrInvalid
+	}
+	ora.mux.Lock()
+	defer ora.mux.Unlock()
+	for len(p) > 0 {
+		if off >= ora.size {
+			return n, io.EOF
+		}
+		var idx = off / CipherChunk
+		if err = ora.chunk(idx); err != nil {
+			return
+		}
+		var c = copy(p, ora.buf[off-idx*CipherChunk:])
+		p = p[c:]
+		n += c
+		off += int64(c)
+	}
+	return
+}
+
+// CipherFile structure gives random access to nested into package
+// encrypted file, decrypting its chunks on demand.
+// RFile interface implementation.
+type CipherFile struct {
+	*io.SectionReader
+	raw  RFile
+	tags TagsetRaw // has fs.FileInfo interface
+}
+
+// NewCipherFile creates CipherFile based on given file with raw data
+// and tagset with cipher tags.
+func NewCipherFile(raw RFile, aead cipher.AEAD, ts TagsetRaw) (*CipherFile, error) {
+	if alg, _ := ts.TagByte(TIDcipher); alg != CipherAESGCM {
+		return nil, &ErrTag{ErrCipherAlg, ts.Path(), TIDcipher}
+	}
+	if aead == nil {
+		return nil, &ErrTag{ErrNoKey, ts.Path(), TIDcipher}
+	}
+	var nonce, _ = ts.Get(TIDnonce)
+	var _, size = ts.Pos()
+	var ora, err = NewOpenReaderAt(raw, aead, nonce, int64(size))
+	if err != nil {
+		return nil, &ErrTag{err, ts.Path(), TIDnonce}
+	}
+	return &CipherFile{
+		SectionReader: io.NewSectionReader(ora, 0, ora.Size()),
+		raw:           raw,
+		tags:          ts,
+	}, nil
+}
+
+// Stat is for fs.File interface compatibility.
+func (f *CipherFile) Stat() (fs.FileInfo, error) {
+	return f.tags, nil
+}
+
+// Close closes file with raw data.
+func (f *CipherFile) Close() error {
+	return f.raw.Close()
+}
+
+// The End.
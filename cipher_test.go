@@ -0,0 +1,162 @@
+package wpk_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+	"github.com/schwarzlichtbezirk/wpk/fsys"
+	"github.com/schwarzlichtbezirk/wpk/mmap"
+)
+
+var cipherkey = []byte("0123456789abcdef0123456789abcdef")
+
+// Test packing with encryption, and random access to encrypted files
+// by each tagger type.
+func TestCipher(t *testing.T) {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	defer os.Remove(testpack)
+
+	var rnd = rand.New(rand.NewSource(1))
+	var bigdata = make([]byte, 3*wpk.CipherChunk+1000)
+	rnd.Read(bigdata)
+	var evendata = make([]byte, 2*wpk.CipherChunk)
+	rnd.Read(evendata)
+	var cipherdata = map[string][]byte{
+		"big.dat":    bigdata,
+		"even.dat":   evendata,
+		"empty.dat":  {},
+		"lorem.txt":  compdata["text/lorem.txt"],
+		"sample.txt": memdata["sample.txt"],
+	}
+
+	// open temporary file for read/write
+	if fwpk, err = os.OpenFile(testpack, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	// starts new package
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetCompress(wpk.CompByMIME(wpk.CompDeflate))
+	pkg.SetSolid(1024, 256)
+	if err = pkg.SetCipher(cipherkey); err != nil {
+		t.Fatal(err)
+	}
+	// put content
+	for name, data := range cipherdata {
+		if _, err = pkg.PackData(fwpk, bytes.NewReader(data), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// finalize
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// check up that data is not readable
+	for _, name := range []string{"big.dat", "lorem.txt", "sample.txt"} {
+		var ts, _ = pkg.GetTagset(name)
+		if !ts.Has(wpk.TIDcipher) || !ts.Has(wpk.TIDnonce) {
+			t.Fatalf("file '%s' has no cipher tags", name)
+		}
+	}
+	var ts, _ = pkg.GetTagset("big.dat")
+	var offset, size = ts.Pos()
+	var raw = make([]byte, size)
+	if _, err = fwpk.ReadAt(raw, int64(offset)); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, bigdata[:64]) {
+		t.Fatal("encrypted file contains plain data")
+	}
+
+	// check that files can not be opened without key
+	var tgr wpk.Tagger
+	if tgr, err = bulk.MakeTagger(testpack); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tgr.OpenTagset(ts); !errors.Is(err, wpk.ErrNoKey) {
+		t.Fatalf("expected error on file opening without key, got %v", err)
+	}
+	tgr.Close()
+
+	// check that files can not be read with wrong key
+	if tgr, err = wpk.MakeCipherTagger(bulk.MakeTagger, testpack, []byte("fedcba9876543210fedcba9876543210")); err != nil {
+		t.Fatal(err)
+	}
+	var f wpk.RFile
+	if f, err = tgr.OpenTagset(ts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadAll(f); err == nil {
+		t.Fatal("expected error on file reading with wrong key")
+	}
+	f.Close()
+	tgr.Close()
+
+	for mode, maketagger := range map[string]func(string) (wpk.Tagger, error){
+		"bulk": bulk.MakeTagger,
+		"mmap": mmap.MakeTagger,
+		"fsys": fsys.MakeTagger,
+	} {
+		t.Run(mode, func(t *testing.T) {
+			var pkg = wpk.NewPackage()
+			if err = pkg.OpenFile(testpack); err != nil {
+				t.Fatal(err)
+			}
+			if pkg.Tagger, err = wpk.MakeCipherTagger(maketagger, testpack, cipherkey); err != nil {
+				t.Fatal(err)
+			}
+			defer pkg.Close()
+
+			for name, data := range cipherdata {
+				var b []byte
+				if b, err = pkg.ReadFile(name); err != nil {
+					t.Fatalf("can not read '%s': %v", name, err)
+				}
+				if !bytes.Equal(b, data) {
+					t.Fatalf("content of '%s' is not equal to original", name)
+				}
+			}
+
+			// random access across chunks boundary
+			var f wpk.RFile
+			var ts, _ = pkg.GetTagset("big.dat")
+			if f, err = pkg.OpenTagset(ts); err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var part = make([]byte, 5000)
+			var pos = int64(2*wpk.CipherChunk - 2000)
+			if _, err = f.ReadAt(part, pos); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(part, bigdata[pos:pos+5000]) {
+				t.Fatal("random access read gives wrong content")
+			}
+			if _, err = f.Seek(-100, io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			var tail []byte
+			if tail, err = io.ReadAll(f); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(tail, bigdata[len(bigdata)-100:]) {
+				t.Fatal("read after seek gives wrong content")
+			}
+		})
+	}
+}
+
+// The End.
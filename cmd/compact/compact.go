@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/util"
+)
+
+// command line settings
+var (
+	SrcFile string
+	DstFile string
+	Split   bool
+	SignHex string
+)
+
+var (
+	ErrSameFile = errors.New("destination file can not be the same as source")
+)
+
+func parseargs() {
+	flag.StringVar(&SrcFile, "src", "", "full path to source package file")
+	flag.StringVar(&DstFile, "dst", "", "full path to output compacted package file")
+	flag.BoolVar(&Split, "split", false, "write compacted package to splitted files")
+	flag.StringVar(&SignHex, "sign", "", "Ed25519 private key seed in hexadecimal representation to sign compacted package, signature of source package is dropped without it")
+	flag.Parse()
+}
+
+func checkargs() (ec int) { // returns error counter
+	SrcFile = util.ToSlash(util.Envfmt(SrcFile, nil))
+	if SrcFile == "" {
+		log.Println("source file does not specified")
+		ec++
+	} else if ok, _ := wpk.FileExists(SrcFile); !ok {
+		log.Printf("source file '%s' does not exist", SrcFile)
+		ec++
+	}
+
+	DstFile = util.ToSlash(util.Envfmt(DstFile, nil))
+	if DstFile == "" {
+		log.Println("destination file does not specified")
+		ec++
+	} else if ok, _ := wpk.DirExists(path.Dir(DstFile)); !ok {
+		log.Println("destination path does not exist")
+		ec++
+	}
+
+	if SignHex != "" {
+		if key, err := hex.DecodeString(SignHex); err != nil {
+			log.Println("sign key is not in hexadecimal representation")
+			ec++
+		} else if err = wpk.NewPackage().SetSigner(key); err != nil {
+			log.Println(err.Error())
+			ec++
+		}
+	}
+
+	return
+}
+
+// samefile returns true if both paths refer to the same existing file,
+// regardless of relative paths and symbolic links.
+func samefile(path1, path2 string) bool {
+	var fi1, err1 = os.Stat(path1)
+	var fi2, err2 = os.Stat(path2)
+	return err1 == nil && err2 == nil && os.SameFile(fi1, fi2)
+}
+
+func compactpackage() (err error) {
+	var pkg = wpk.NewPackage()
+	if err = pkg.OpenFile(SrcFile); err != nil {
+		return
+	}
+
+	// open source data file
+	var datpath = SrcFile
+	if pkg.IsSplitted() {
+		datpath = wpk.MakeDataPath(SrcFile)
+	}
+	var src *os.File
+	if src, err = os.Open(datpath); err != nil {
+		return
+	}
+	defer src.Close()
+
+	var pkgfile, datfile = DstFile, DstFile
+	if Split {
+		pkgfile, datfile = wpk.MakeTagsPath(pkgfile), wpk.MakeDataPath(datfile)
+	}
+	for _, dst := range []string{pkgfile, datfile} {
+		if samefile(dst, SrcFile) || samefile(dst, datpath) {
+			err = ErrSameFile
+			return
+		}
+	}
+
+	if SignHex != "" {
+		var key, _ = hex.DecodeString(SignHex)
+		if err = pkg.SetSigner(key); err != nil {
+			return
+		}
+	} else if pkg.GetInfo().Has(wpk.TIDsign) {
+		log.Println("signature of source package is dropped, compacted package is not signed")
+	}
+
+	// open package file to write
+	var fwpk, fwpf wpk.WriteSeekCloser
+	if fwpk, err = os.OpenFile(pkgfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		return
+	}
+	defer fwpk.Close()
+
+	if Split {
+		if fwpf, err = os.OpenFile(datfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+			return
+		}
+		defer fwpf.Close()
+
+		log.Printf("destination tags part:  %s\n", pkgfile)
+		log.Printf("destination files part: %s\n", datfile)
+	} else {
+		log.Printf("destination file: %s\n", pkgfile)
+	}
+
+	var size = pkg.DataSize()
+	var reclaimed int64
+	if reclaimed, err = pkg.Compact(src, fwpk, fwpf); err != nil {
+		return
+	}
+	log.Printf("data size: %d bytes, compacted to %d bytes, reclaimed %d bytes", size, pkg.DataSize(), reclaimed)
+	return
+}
+
+func main() {
+	parseargs()
+	if checkargs() > 0 {
+		os.Exit(2)
+	}
+
+	log.Println("starts")
+	if err := compactpackage(); err != nil {
+		log.Println(err.Error())
+		os.Exit(1)
+	}
+	log.Println("done.")
+}
+
+// The End.
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+	"github.com/schwarzlichtbezirk/wpk/util"
+)
+
+// command line settings
+var (
+	OldFile string
+	NewFile string
+	DstFile string
+	Delta   bool
+)
+
+func parseargs() {
+	flag.StringVar(&OldFile, "old", "", "full path to package file of previous version")
+	flag.StringVar(&NewFile, "new", "", "full path to package file of new version")
+	flag.StringVar(&DstFile, "dst", "", "full path to output patch package file")
+	flag.BoolVar(&Delta, "delta", false, "pack changed files as binary deltas against previous version")
+	flag.Parse()
+}
+
+func checkargs() (ec int) { // returns error counter
+	OldFile = util.ToSlash(util.Envfmt(OldFile, nil))
+	if OldFile == "" {
+		log.Println("previous version package does not specified")
+		ec++
+	} else if ok, _ := wpk.FileExists(OldFile); !ok {
+		log.Printf("previous version package '%s' does not exist", OldFile)
+		ec++
+	}
+
+	NewFile = util.ToSlash(util.Envfmt(NewFile, nil))
+	if NewFile == "" {
+		log.Println("new version package does not specified")
+		ec++
+	} else if ok, _ := wpk.FileExists(NewFile); !ok {
+		log.Printf("new version package '%s' does not exist", NewFile)
+		ec++
+	}
+
+	DstFile = util.ToSlash(util.Envfmt(DstFile, nil))
+	if DstFile == "" {
+		log.Println("destination file does not specified")
+		ec++
+	} else if ok, _ := wpk.DirExists(path.Dir(DstFile)); !ok {
+		log.Println("destination path does not exist")
+		ec++
+	} else if DstFile == OldFile || DstFile == NewFile {
+		log.Println("destination file can not be the same as source")
+		ec++
+	}
+
+	return
+}
+
+func openpackage(pkgpath string) (pkg *wpk.Package, err error) {
+	pkg = wpk.NewPackage()
+	if err = pkg.OpenFile(pkgpath); err != nil {
+		return
+	}
+	var fpath = pkgpath
+	if pkg.IsSplitted() {
+		fpath = wpk.MakeDataPath(pkgpath)
+	}
+	pkg.Tagger, err = bulk.MakeTagger(fpath)
+	return
+}
+
+func diffpackage() (err error) {
+	var oldpkg, newpkg *wpk.Package
+	if oldpkg, err = openpackage(OldFile); err != nil {
+		return
+	}
+	defer oldpkg.Close()
+	if newpkg, err = openpackage(NewFile); err != nil {
+		return
+	}
+	defer newpkg.Close()
+
+	// open package file to write
+	var fwpk *os.File
+	if fwpk, err = os.OpenFile(DstFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		return
+	}
+	defer fwpk.Close()
+	log.Printf("destination file: %s\n", DstFile)
+
+	var patch = wpk.NewPackage()
+	if err = patch.Begin(fwpk, nil); err != nil {
+		return
+	}
+	var d wpk.Diff
+	if Delta {
+		d, err = patch.PackDeltaDiff(fwpk, newpkg, oldpkg)
+	} else {
+		d, err = patch.PackDiff(fwpk, newpkg, oldpkg)
+	}
+	if err != nil {
+		return
+	}
+	if err = patch.Sync(fwpk, nil); err != nil {
+		return
+	}
+	for _, fkey := range d.Added {
+		log.Printf("added: %s", fkey)
+	}
+	for _, fkey := range d.Changed {
+		log.Printf("changed: %s", fkey)
+	}
+	for _, fkey := range d.Deleted {
+		log.Printf("deleted: %s", fkey)
+	}
+	log.Printf("added %d, changed %d, deleted %d files, patch data size: %d bytes",
+		len(d.Added), len(d.Changed), len(d.Deleted), patch.DataSize())
+	return
+}
+
+func main() {
+	parseargs()
+	if checkargs() > 0 {
+		return
+	}
+
+	log.Println("starts")
+	if err := diffpackage(); err != nil {
+		log.Println(err.Error())
+		return
+	}
+	log.Println("done.")
+}
+
+// The End.
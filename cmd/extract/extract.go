@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"errors"
 	"flag"
 	"io"
@@ -10,25 +11,25 @@ import (
 	"strings"
 
 	"github.com/schwarzlichtbezirk/wpk"
-	"github.com/schwarzlichtbezirk/wpk/bulk"
-	"github.com/schwarzlichtbezirk/wpk/fsys"
-	"github.com/schwarzlichtbezirk/wpk/mmap"
+	"github.com/schwarzlichtbezirk/wpk/cmd/internal/pkgopt"
 	"github.com/schwarzlichtbezirk/wpk/util"
 )
 
 // command line settings
 var (
-	srcfile string
-	SrcList []string
-	DstPath string
-	MkDst   bool
-	OrgTime bool
-	ShowLog bool
-	PkgMode string
+	srcfile  string
+	trusthex string
+	SrcList  []string
+	DstPath  string
+	MkDst    bool
+	OrgTime  bool
+	ShowLog  bool
+	PkgMode  string
+	KeyHex   string
+	Key      []byte
+	Trusted  []ed25519.PublicKey
 )
 
-var pkg = wpk.NewPackage()
-
 var (
 	ErrNoWay = errors.New("no way to here")
 )
@@ -40,6 +41,8 @@ func parseargs() {
 	flag.BoolVar(&OrgTime, "ft", false, "change the access and modification times of extracted files to original file times")
 	flag.BoolVar(&ShowLog, "sl", true, "show process log for each extracting file")
 	flag.StringVar(&PkgMode, "pm", "mmap", "package opening mode, can be \"bulk\", \"mmap\" and \"fsys\"")
+	flag.StringVar(&KeyHex, "key", "", "key in hexadecimal representation to decrypt files encrypted by AES-GCM")
+	flag.StringVar(&trusthex, "trust", "", "trusted Ed25519 public key in hexadecimal representation to verify package signature, or list of keys divided by ';'")
 	flag.Parse()
 }
 
@@ -80,54 +83,36 @@ func checkargs() int {
 		}
 	}
 
-	if PkgMode != "bulk" && PkgMode != "mmap" && PkgMode != "fsys" {
-		log.Println("given package opening type does not supported")
-		ec++
-	}
+	ec += pkgopt.CheckMode(PkgMode)
 
-	return ec
-}
+	var n int
+	Key, n = pkgopt.ParseKey(KeyHex)
+	ec += n
+	Trusted, n = pkgopt.ParseTrusted(trusthex)
+	ec += n
 
-func openpackage(pkgpath string) (err error) {
-	if err = pkg.OpenFile(pkgpath); err != nil {
-		return
-	}
-	var fpath string
-	if pkg.IsSplitted() {
-		fpath = wpk.MakeDataPath(pkgpath)
-	} else {
-		fpath = pkgpath
-	}
-	switch PkgMode {
-	case "bulk":
-		if pkg.Tagger, err = bulk.MakeTagger(fpath); err != nil {
-			return
-		}
-	case "mmap":
-		if pkg.Tagger, err = mmap.MakeTagger(fpath); err != nil {
-			return
-		}
-	case "fsys":
-		if pkg.Tagger, err = fsys.MakeTagger(fpath); err != nil {
-			return
-		}
-	default:
-		panic(ErrNoWay)
-	}
-	return
+	return ec
 }
 
 func readpackage() (err error) {
 	log.Printf("destination path: %s", DstPath)
 
+	// all packages are opened at once, so files packed as binary deltas
+	// are reconstructed from base files placed at other packages
+	var u wpk.Union
+	defer u.Close()
 	for _, pkgpath := range SrcList {
-		log.Printf("source package: %s", pkgpath)
-		func() {
-			if err = openpackage(pkgpath); err != nil {
-				return
-			}
-			defer pkg.Close()
+		var pkg *wpk.Package
+		if pkg, err = pkgopt.OpenPackage(pkgpath, PkgMode, Key, Trusted); err != nil {
+			return
+		}
+		u.List = append(u.List, pkg)
+	}
+	u.WrapDelta()
 
+	for i, pkg := range u.List {
+		log.Printf("source package: %s", SrcList[i])
+		func() {
 			var num, sum int64
 			pkg.Enum(func(fkey string, ts wpk.TagsetRaw) (next bool) {
 				defer func() {
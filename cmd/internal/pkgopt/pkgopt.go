@@ -0,0 +1,105 @@
+package pkgopt
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+	"github.com/schwarzlichtbezirk/wpk/fsys"
+	"github.com/schwarzlichtbezirk/wpk/mmap"
+)
+
+var (
+	ErrNoMode = errors.New("given package opening mode does not supported")
+)
+
+// Taggers is the list of functions to make tagger
+// for each supported package opening mode.
+var Taggers = map[string]func(string) (wpk.Tagger, error){
+	"bulk": bulk.MakeTagger,
+	"mmap": mmap.MakeTagger,
+	"fsys": fsys.MakeTagger,
+}
+
+// CheckMode logs error if given package opening mode is not supported,
+// and returns number of errors.
+func CheckMode(mode string) (ec int) {
+	if _, ok := Taggers[mode]; !ok {
+		log.Println("given package opening type does not supported")
+		ec++
+	}
+	return
+}
+
+// ParseKey decodes cipher key given in hexadecimal representation.
+// Returns nil key for empty string. Logs errors and returns number of them.
+func ParseKey(keyhex string) (key []byte, ec int) {
+	if keyhex == "" {
+		return
+	}
+	var err error
+	if key, err = hex.DecodeString(keyhex); err != nil {
+		log.Println("cipher key is not in hexadecimal representation")
+		ec++
+		return
+	}
+	if _, err = wpk.NewAEAD(key); err != nil {
+		log.Println(err.Error())
+		ec++
+	}
+	return
+}
+
+// ParseTrusted decodes list of Ed25519 public keys given in hexadecimal
+// representation and divided by ';'. Logs errors and returns number of them.
+func ParseTrusted(trusthex string) (list []ed25519.PublicKey, ec int) {
+	for i, keyhex := range strings.Split(trusthex, ";") {
+		if keyhex == "" {
+			continue
+		}
+		var key, err = hex.DecodeString(keyhex)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			log.Printf("trusted key #%d is not 32 bytes in hexadecimal representation", i+1)
+			ec++
+			continue
+		}
+		list = append(list, key)
+	}
+	return
+}
+
+// MakeTagger creates tagger for package data file with given path
+// by given opening mode. Tagger decrypts files if key is given.
+func MakeTagger(mode, fpath string, key []byte) (wpk.Tagger, error) {
+	var maketagger, ok = Taggers[mode]
+	if !ok {
+		return nil, ErrNoMode
+	}
+	if key != nil {
+		return wpk.MakeCipherTagger(maketagger, fpath, key)
+	}
+	return maketagger(fpath)
+}
+
+// OpenPackage opens package with given path, checks up its signature
+// by trusted keys if they are given, and makes tagger for package data
+// by given opening mode.
+func OpenPackage(pkgpath, mode string, key []byte, trusted []ed25519.PublicKey) (pkg *wpk.Package, err error) {
+	pkg = wpk.NewPackage()
+	pkg.SetTrusted(trusted...)
+	if err = pkg.OpenFile(pkgpath); err != nil {
+		return
+	}
+	var fpath = pkgpath
+	if pkg.IsSplitted() {
+		fpath = wpk.MakeDataPath(pkgpath)
+	}
+	pkg.Tagger, err = MakeTagger(mode, fpath, key)
+	return
+}
+
+// The End.
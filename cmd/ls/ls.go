@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	lw "github.com/schwarzlichtbezirk/wpk/luawpk"
+	"github.com/schwarzlichtbezirk/wpk/util"
+)
+
+// command line settings
+var (
+	SrcFile string
+	Pattern string
+	Tree    bool
+	Format  string
+	tagsarg string
+	TagList []wpk.TID
+)
+
+var (
+	ErrNoWay = errors.New("no way to here")
+)
+
+func parseargs() {
+	flag.StringVar(&SrcFile, "src", "", "package full file name")
+	flag.StringVar(&Pattern, "glob", "", "glob pattern to filter listed files, i.e. \"img/*.jpg\"")
+	flag.BoolVar(&Tree, "tree", false, "print files as tree of directories, for text output format only")
+	flag.StringVar(&Format, "fmt", "text", "output format, can be \"text\", \"json\" and \"csv\"")
+	flag.StringVar(&tagsarg, "tags", "", "list of tags names divided by ',' to print for each file additionally, i.e. \"fid,crc32c,sha256\"")
+	flag.Parse()
+}
+
+func checkargs() int {
+	var ec = 0 // error counter
+
+	SrcFile = util.ToSlash(util.Envfmt(SrcFile, nil))
+	if SrcFile == "" {
+		log.Println("package file does not specified")
+		ec++
+	} else if ok, _ := wpk.FileExists(SrcFile); !ok {
+		log.Printf("package file '%s' does not exist", SrcFile)
+		ec++
+	}
+
+	if Format != "text" && Format != "json" && Format != "csv" {
+		log.Println("given output format does not supported")
+		ec++
+	}
+
+	if _, err := path.Match(Pattern, ""); err != nil {
+		log.Println("glob pattern is malformed")
+		ec++
+	}
+
+	for _, name := range strings.Split(tagsarg, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if tid, ok := lw.NameTid[name]; ok {
+			TagList = append(TagList, tid)
+		} else if n, err := strconv.ParseUint(name, 10, 16); err == nil {
+			TagList = append(TagList, wpk.TID(n))
+		} else {
+			log.Printf("tag name '%s' is undefined", name)
+			ec++
+		}
+	}
+
+	return ec
+}
+
+// tagname returns name of tag, or its number if it has no name.
+func tagname(tid wpk.TID) string {
+	if name, ok := lw.TidName[tid]; ok {
+		return name
+	}
+	return strconv.Itoa(int(tid))
+}
+
+// tagstr returns string presentation of tag value.
+func tagstr(tid wpk.TID, tag wpk.TagRaw) string {
+	switch lw.TidType[tid] {
+	case lw.TTstr:
+		var val, _ = tag.TagStr()
+		return val
+	case lw.TTbool:
+		var val, _ = tag.TagBool()
+		return strconv.FormatBool(val)
+	case lw.TTuint:
+		var val, _ = tag.TagUint()
+		return strconv.FormatUint(uint64(val), 10)
+	case lw.TTnum:
+		var val, _ = tag.TagNumber()
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case lw.TTtime:
+		var val, _ = tag.TagTime()
+		return val.Format(lw.ISO8601)
+	default:
+		return hex.EncodeToString(tag)
+	}
+}
+
+// HeaderInfo is package header fields and info tagset.
+type HeaderInfo struct {
+	Path     string            `json:"path"`
+	Count    int               `json:"count"`
+	FttSize  uint              `json:"fttsize"`
+	DataSize uint              `json:"datasize"`
+	Splitted bool              `json:"splitted"`
+	Info     map[string]string `json:"info,omitempty"`
+}
+
+// FileInfo is listed file properties.
+type FileInfo struct {
+	Key   string            `json:"key"`
+	Size  int64             `json:"size"`
+	MTime string            `json:"mtime,omitempty"`
+	MIME  string            `json:"mime,omitempty"`
+	Tags  map[string]string `json:"tags,omitempty"`
+}
+
+// Listing is whole output for JSON format.
+type Listing struct {
+	Header HeaderInfo `json:"header"`
+	Files  []FileInfo `json:"files"`
+}
+
+func makefileinfo(fkey string, ts wpk.TagsetRaw) (fi FileInfo) {
+	fi.Key = fkey
+	fi.Size = ts.Size()
+	if mtime, ok := ts.TagTime(wpk.TIDmtime); ok {
+		fi.MTime = mtime.Format(lw.ISO8601)
+	}
+	fi.MIME, _ = ts.TagStr(wpk.TIDmime)
+	for _, tid := range TagList {
+		if tag, ok := ts.Get(tid); ok {
+			if fi.Tags == nil {
+				fi.Tags = map[string]string{}
+			}
+			fi.Tags[tagname(tid)] = tagstr(tid, tag)
+		}
+	}
+	return
+}
+
+func readheader() (hi HeaderInfo, err error) {
+	var r *os.File
+	if r, err = os.Open(SrcFile); err != nil {
+		return
+	}
+	defer r.Close()
+
+	var hdr wpk.Header
+	var info wpk.TagsetRaw
+	if hdr, info, err = wpk.GetPackageInfo(r); err != nil {
+		return
+	}
+	hi.Path = SrcFile
+	hi.Count, hi.FttSize, hi.DataSize = hdr.Count(), hdr.FttSize(), hdr.DataSize()
+	var tsi = info.Iterator()
+	for tsi.Next() {
+		if hi.Info == nil {
+			hi.Info = map[string]string{}
+		}
+		hi.Info[tagname(tsi.TID())] = tagstr(tsi.TID(), tsi.Tag())
+	}
+	return
+}
+
+func listfiles(pkg *wpk.Package) (list []FileInfo, err error) {
+	var keys []string
+	if Pattern != "" {
+		if keys, err = pkg.Glob(Pattern); err != nil {
+			return
+		}
+	} else {
+		pkg.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+			keys = append(keys, fkey)
+			return true
+		})
+	}
+	for _, fkey := range keys {
+		var ts, _ = pkg.GetTagset(fkey)
+		list = append(list, makefileinfo(fkey, ts))
+	}
+	return
+}
+
+func printtext(hi HeaderInfo, list []FileInfo) {
+	fmt.Printf("package:   %s\n", hi.Path)
+	fmt.Printf("files:     %d\n", hi.Count)
+	fmt.Printf("tags size: %d bytes\n", hi.FttSize)
+	fmt.Printf("data size: %d bytes\n", hi.DataSize)
+	fmt.Printf("splitted:  %t\n", hi.Splitted)
+	var names = make([]string, 0, len(hi.Info))
+	for name := range hi.Info {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("info %s: %s\n", name, hi.Info[name])
+	}
+	fmt.Println()
+	for _, fi := range list {
+		fmt.Printf("%10d  %-24s  %-24s  %s%s\n", fi.Size, fi.MTime, fi.MIME, fi.Key, fmttags(fi.Tags))
+	}
+}
+
+func fmttags(tags map[string]string) string {
+	var sb strings.Builder
+	for _, tid := range TagList {
+		var name = tagname(tid)
+		if val, ok := tags[name]; ok {
+			fmt.Fprintf(&sb, "  %s=%s", name, val)
+		}
+	}
+	return sb.String()
+}
+
+// printtree writes directories tree with files matched to pattern,
+// directories without matched files are omitted.
+func printtree(w io.Writer, pkg *wpk.Package, dir string, indent string) (err error) {
+	var list []fs.DirEntry
+	if list, err = pkg.ReadDir(dir); err != nil {
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	for _, de := range list {
+		var fpath = util.JoinPath(dir, de.Name())
+		if de.IsDir() {
+			var sub strings.Builder
+			if err = printtree(&sub, pkg, fpath, indent+"  "); err != nil {
+				return
+			}
+			if sub.Len() > 0 || Pattern == "" {
+				fmt.Fprintf(w, "%s%s/\n", indent, de.Name())
+				io.WriteString(w, sub.String())
+			}
+			continue
+		}
+		if Pattern != "" {
+			if matched, _ := path.Match(Pattern, fpath); !matched {
+				continue
+			}
+		}
+		var ts, _ = pkg.GetTagset(fpath)
+		var fi = makefileinfo(fpath, ts)
+		fmt.Fprintf(w, "%s%s  %d bytes%s\n", indent, de.Name(), fi.Size, fmttags(fi.Tags))
+	}
+	return
+}
+
+func printcsv(list []FileInfo) error {
+	var w = csv.NewWriter(os.Stdout)
+	var head = []string{"key", "size", "mtime", "mime"}
+	for _, tid := range TagList {
+		head = append(head, tagname(tid))
+	}
+	if err := w.Write(head); err != nil {
+		return err
+	}
+	for _, fi := range list {
+		var rec = []string{fi.Key, strconv.FormatInt(fi.Size, 10), fi.MTime, fi.MIME}
+		for _, tid := range TagList {
+			rec = append(rec, fi.Tags[tagname(tid)])
+		}
+		if err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func listpackage() (err error) {
+	var hi HeaderInfo
+	if hi, err = readheader(); err != nil {
+		return
+	}
+
+	var pkg = wpk.NewPackage()
+	if err = pkg.OpenFile(SrcFile); err != nil {
+		return
+	}
+	hi.Splitted = pkg.IsSplitted()
+
+	if Tree && Format == "text" {
+		printtext(hi, nil)
+		return printtree(os.Stdout, pkg, ".", "")
+	}
+
+	var list []FileInfo
+	if list, err = listfiles(pkg); err != nil {
+		return
+	}
+	switch Format {
+	case "text":
+		printtext(hi, list)
+	case "json":
+		var enc = json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(Listing{Header: hi, Files: list})
+	case "csv":
+		err = printcsv(list)
+	default:
+		panic(ErrNoWay)
+	}
+	return
+}
+
+func main() {
+	parseargs()
+	if checkargs() > 0 {
+		os.Exit(2)
+	}
+
+	if err := listpackage(); err != nil {
+		log.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+// The End.
@@ -0,0 +1,159 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/schwarzlichtbezirk/wpk/mount"
+)
+
+// fuseNode is FUSE inode over node of mounted file system.
+type fuseNode struct {
+	fusefs.Inode
+	node *mount.Node
+}
+
+var (
+	_ fusefs.NodeLookuper  = (*fuseNode)(nil)
+	_ fusefs.NodeReaddirer = (*fuseNode)(nil)
+	_ fusefs.NodeGetattrer = (*fuseNode)(nil)
+	_ fusefs.NodeOpener    = (*fuseNode)(nil)
+)
+
+// errno converts error to FUSE status.
+func errno(err error) syscall.Errno {
+	return fusefs.ToErrno(err)
+}
+
+// setattr fills FUSE attributes by node attributes.
+func setattr(out *fuse.Attr, n *mount.Node) {
+	var attr = n.Attr()
+	out.Size = attr.Size
+	out.Blocks = (attr.Size + 511) / 512
+	out.Mode = uint32(attr.Mode.Perm())
+	if n.IsDir() {
+		out.Mode |= fuse.S_IFDIR
+	} else {
+		out.Mode |= fuse.S_IFREG
+	}
+	out.SetTimes(&attr.Atime, &attr.Mtime, &attr.Ctime)
+}
+
+// stable returns stable attributes of node.
+func stable(n *mount.Node) fusefs.StableAttr {
+	if n.IsDir() {
+		return fusefs.StableAttr{Mode: fuse.S_IFDIR}
+	}
+	return fusefs.StableAttr{Mode: fuse.S_IFREG}
+}
+
+// Lookup finds nested into directory node with given name.
+func (fn *fuseNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+	var child, err = fn.node.Lookup(name)
+	if err != nil {
+		return nil, errno(err)
+	}
+	setattr(&out.Attr, child)
+	return fn.NewInode(ctx, &fuseNode{node: child}, stable(child)), 0
+}
+
+// Readdir returns directory entries.
+func (fn *fuseNode) Readdir(ctx context.Context) (fusefs.DirStream, syscall.Errno) {
+	var list, err = fn.node.ReadDir()
+	if err != nil {
+		return nil, errno(err)
+	}
+	var entries = make([]fuse.DirEntry, len(list))
+	for i, child := range list {
+		entries[i] = fuse.DirEntry{
+			Name: child.Name(),
+			Mode: stable(child).Mode,
+		}
+	}
+	return fusefs.NewListDirStream(entries), 0
+}
+
+// Getattr returns node attributes.
+func (fn *fuseNode) Getattr(ctx context.Context, f fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	setattr(&out.Attr, fn.node)
+	return 0
+}
+
+// Open opens file node for reading only.
+func (fn *fuseNode) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_APPEND|syscall.O_TRUNC) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	var h, err = fn.node.Open()
+	if err != nil {
+		return nil, 0, errno(err)
+	}
+	// package content is immutable, so kernel can cache it
+	return &fuseHandle{h: h}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+// fuseHandle is FUSE file handle over opened file.
+type fuseHandle struct {
+	h *mount.Handle
+}
+
+var (
+	_ fusefs.FileReader   = (*fuseHandle)(nil)
+	_ fusefs.FileReleaser = (*fuseHandle)(nil)
+)
+
+// Read reads file content at given offset.
+func (fh *fuseHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	var n, err = fh.h.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, errno(err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+// Release closes the file.
+func (fh *fuseHandle) Release(ctx context.Context) syscall.Errno {
+	return errno(fh.h.Close())
+}
+
+// mountfs mounts file system with given root node read-only to given
+// directory, and serves it until unmount or interrupt signal.
+func mountfs(root *mount.Node, dir string) (err error) {
+	var server *fuse.Server
+	if server, err = fusefs.Mount(dir, &fuseNode{node: root}, &fusefs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:  "wpk",
+			Name:    "wpk",
+			Options: []string{"ro"},
+			Debug:   Debug,
+		},
+	}); err != nil {
+		return
+	}
+
+	// unmount on interrupt
+	go func() {
+		var sigint = make(chan os.Signal, 1)
+		signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+		<-sigint
+		log.Println("unmount")
+		if err := server.Unmount(); err != nil {
+			log.Println(err.Error())
+		}
+	}()
+
+	log.Println("mounted, press Ctrl+C to unmount")
+	server.Wait()
+	return
+}
+
+// The End.
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+
+	"github.com/schwarzlichtbezirk/wpk/mount"
+)
+
+// ErrNoFUSE is error on platform without FUSE support.
+var ErrNoFUSE = errors.New("FUSE is not supported on this platform")
+
+// mountfs is stub for platforms without FUSE.
+func mountfs(root *mount.Node, dir string) error {
+	return ErrNoFUSE
+}
+
+// The End.
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/cmd/internal/pkgopt"
+	"github.com/schwarzlichtbezirk/wpk/mount"
+	"github.com/schwarzlichtbezirk/wpk/util"
+)
+
+// command line settings
+var (
+	srcfile  string
+	trusthex string
+	SrcList  []string
+	DstPath  string
+	PkgMode  string
+	Debug    bool
+	KeyHex   string
+	Key      []byte
+	Trusted  []ed25519.PublicKey
+)
+
+func parseargs() {
+	flag.StringVar(&srcfile, "src", "", "package full file name, or list of files divided by ';' to mount as union, where first package wins")
+	flag.StringVar(&DstPath, "dst", "", "full path to empty directory to mount package to")
+	flag.StringVar(&PkgMode, "pm", "mmap", "package opening mode, can be \"bulk\", \"mmap\" and \"fsys\"")
+	flag.BoolVar(&Debug, "debug", false, "show log of FUSE operations")
+	flag.StringVar(&KeyHex, "key", "", "key in hexadecimal representation to decrypt files encrypted by AES-GCM")
+	flag.StringVar(&trusthex, "trust", "", "trusted Ed25519 public key in hexadecimal representation to verify package signature, or list of keys divided by ';'")
+	flag.Parse()
+}
+
+func checkargs() int {
+	var ec = 0 // error counter
+
+	for i, fpath := range strings.Split(srcfile, ";") {
+		if fpath == "" {
+			continue
+		}
+		fpath = util.ToSlash(util.Envfmt(fpath, nil))
+		if ok, _ := wpk.FileExists(fpath); !ok {
+			log.Printf("source file #%d '%s' does not exist", i+1, fpath)
+			ec++
+			continue
+		}
+		SrcList = append(SrcList, fpath)
+	}
+	if len(srcfile) == 0 {
+		log.Println("package file does not specified")
+		ec++
+	}
+
+	DstPath = util.ToSlash(util.Envfmt(DstPath, nil))
+	if DstPath == "" {
+		log.Println("mount point does not specified")
+		ec++
+	} else if ok, _ := wpk.DirExists(DstPath); !ok {
+		log.Println("mount point directory does not exist")
+		ec++
+	}
+
+	ec += pkgopt.CheckMode(PkgMode)
+
+	var n int
+	Key, n = pkgopt.ParseKey(KeyHex)
+	ec += n
+	Trusted, n = pkgopt.ParseTrusted(trusthex)
+	ec += n
+
+	return ec
+}
+
+func mountpackage() (err error) {
+	var u = wpk.Union{DelList: true} // honour deleted files of patch packages
+	defer u.Close()
+	for _, pkgpath := range SrcList {
+		log.Printf("source package: %s", pkgpath)
+		var pkg *wpk.Package
+		if pkg, err = pkgopt.OpenPackage(pkgpath, PkgMode, Key, Trusted); err != nil {
+			return
+		}
+		u.List = append(u.List, pkg)
+	}
+	u.WrapDelta() // reconstruct files packed as binary deltas
+
+	var mfs mount.FS = &u
+	if len(u.List) == 1 {
+		mfs = u.List[0]
+	}
+	log.Printf("mount point: %s", DstPath)
+	return mountfs(mount.NewRoot(mfs), DstPath)
+}
+
+func main() {
+	parseargs()
+	if checkargs() > 0 {
+		return
+	}
+
+	log.Println("starts")
+	if err := mountpackage(); err != nil {
+		log.Println(err.Error())
+		return
+	}
+	log.Println("done.")
+}
+
+// The End.
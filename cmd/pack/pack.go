@@ -1,7 +1,7 @@
 package main
 
 import (
-	"bytes"
+	"encoding/hex"
 	"flag"
 	"io"
 	"io/fs"
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/schwarzlichtbezirk/wpk"
@@ -25,6 +26,16 @@ var (
 	PutLink bool
 	ShowLog bool
 	Split   bool
+	Comp    string
+	Solid   int
+	KeyHex  string
+	SignHex string
+	Dedup   bool
+	Jobs    int
+	Repro   bool
+	Variant bool
+	Index   bool
+	Trailer bool
 )
 
 func parseargs() {
@@ -34,6 +45,16 @@ func parseargs() {
 	flag.BoolVar(&PutLink, "link", false, "put full path to the original file to each file tagset")
 	flag.BoolVar(&ShowLog, "log", true, "show process log for each extracting file")
 	flag.BoolVar(&Split, "split", false, "write package to splitted files")
+	flag.StringVar(&KeyHex, "key", "", "key in hexadecimal representation to encrypt packed files by AES-GCM, 16, 24 or 32 bytes")
+	flag.StringVar(&SignHex, "sign", "", "Ed25519 private key seed in hexadecimal representation to sign files tags table, 32 bytes")
+	flag.IntVar(&Jobs, "j", 1, "number of workers to read, hash and compress files concurrently, 0 for number of CPUs")
+	flag.BoolVar(&Repro, "repro", false, "reproducible build, packs files in order of keys and stores only modification times clamped to SOURCE_DATE_EPOCH, or to UNIX epoch start if it is not set")
+	flag.BoolVar(&Variant, "variant", false, "pack gzip variants for files with compressible MIME types, and link present '.gz' and '.br' files as variants of its primary files")
+	flag.BoolVar(&Dedup, "dedup", false, "write identical content of files once, files with same content refer to the same data")
+	flag.IntVar(&Solid, "solid", 0, "size of solid block in bytes to group into it files with size up to quarter of block, 0 turns off solid mode")
+	flag.BoolVar(&Index, "index", false, "write index section after files tags table to open package in lazy mode")
+	flag.BoolVar(&Trailer, "trailer", false, "write trailer at the end of single file package, so package can be appended to executable file")
+	flag.StringVar(&Comp, "comp", "none", "compression mode, can be \"none\", \"deflate\" for all files, and \"auto\" to compress textual files only")
 	flag.Parse()
 }
 
@@ -67,6 +88,84 @@ func checkargs() (ec int) { // returns error counter
 		ec++
 	}
 
+	if Comp != "none" && Comp != "deflate" && Comp != "auto" {
+		log.Println("given compression mode does not supported")
+		ec++
+	}
+
+	if KeyHex != "" {
+		if key, err := hex.DecodeString(KeyHex); err != nil {
+			log.Println("cipher key is not in hexadecimal representation")
+			ec++
+		} else if _, err = wpk.NewAEAD(key); err != nil {
+			log.Println(err.Error())
+			ec++
+		}
+	}
+	if SignHex != "" {
+		if key, err := hex.DecodeString(SignHex); err != nil {
+			log.Println("sign key is not in hexadecimal representation")
+			ec++
+		} else if err = wpk.NewPackage().SetSigner(key); err != nil {
+			log.Println(err.Error())
+			ec++
+		}
+	}
+	if _, err := wpk.SourceDateEpoch(); err != nil {
+		log.Printf("SOURCE_DATE_EPOCH is not valid UNIX time: %s", err.Error())
+		ec++
+	}
+	if Jobs < 0 {
+		log.Println("number of workers can not be negative")
+		ec++
+	}
+	if Solid < 0 {
+		log.Println("solid block size can not be negative")
+		ec++
+	}
+
+	return
+}
+
+// sniffmime reads a chunk of file to decide between utf-8 text and binary.
+func sniffmime(fpath string) (ctype string, err error) {
+	const sniffLen = 512
+	var file *os.File
+	if file, err = os.Open(fpath); err != nil {
+		return
+	}
+	defer file.Close()
+
+	var buf [sniffLen]byte
+	var n int
+	if n, err = io.ReadFull(file, buf[:]); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return
+	}
+	err = nil
+	ctype = http.DetectContentType(buf[:n])
+	return
+}
+
+// packlist puts given files into package one by one
+// with streaming of each file content.
+func packlist(pkg *wpk.Package, w io.WriteSeeker, list []wpk.PackSource, done func(string, wpk.TagsetRaw) error) (err error) {
+	for _, src := range list {
+		var ts wpk.TagsetRaw
+		if err = func() (err error) {
+			var file fs.File
+			if file, err = src.Open(); err != nil {
+				return
+			}
+			defer file.Close()
+			ts, err = pkg.PackFile(w, file, src.Key)
+			return
+		}(); err != nil {
+			return
+		}
+		if err = done(src.Key, ts); err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -100,6 +199,32 @@ func writepackage() (err error) {
 	if err = pkg.Begin(fwpk, fwpf); err != nil {
 		return
 	}
+	switch Comp {
+	case "deflate":
+		pkg.SetCompress(wpk.CompAll(wpk.CompDeflate))
+	case "auto":
+		pkg.SetCompress(wpk.CompByMIME(wpk.CompDeflate))
+	}
+	pkg.SetSolid(Solid, Solid/4)
+	pkg.SetDedup(Dedup)
+	pkg.SetIndex(Index)
+	pkg.SetTrailer(Trailer)
+	if Repro {
+		var epoch, _ = wpk.SourceDateEpoch()
+		pkg.SetReproducible(true, epoch)
+	}
+	if KeyHex != "" {
+		var key, _ = hex.DecodeString(KeyHex)
+		if err = pkg.SetCipher(key); err != nil {
+			return
+		}
+	}
+	if SignHex != "" {
+		var key, _ = hex.DecodeString(SignHex)
+		if err = pkg.SetSigner(key); err != nil {
+			return
+		}
+	}
 
 	// data writer
 	var w = fwpk
@@ -110,7 +235,8 @@ func writepackage() (err error) {
 	// write all source folders
 	for i, srcpath := range SrcList {
 		log.Printf("source folder #%d: %s", i+1, srcpath)
-		var num, sum int64
+		var list []wpk.PackSource
+		var keys = map[string]wpk.Void{}
 		fs.WalkDir(os.DirFS(srcpath), ".", func(fkey string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
@@ -118,19 +244,20 @@ func writepackage() (err error) {
 			if d.IsDir() {
 				return nil // file is directory
 			}
-
 			var fpath = util.JoinPath(srcpath, fkey)
-			var file wpk.RFile
-			var ts wpk.TagsetRaw
-			if file, err = os.Open(fpath); err != nil {
-				return err
-			}
-			defer file.Close()
-
-			if ts, err = pkg.PackFile(w, file, fkey); err != nil {
-				return err
-			}
+			keys[fkey] = wpk.Void{}
+			list = append(list, wpk.PackSource{
+				Key: fkey,
+				Open: func() (fs.File, error) {
+					return os.Open(fpath)
+				},
+			})
+			return nil
+		})
 
+		var num, sum, vnum int64
+		var done = func(fkey string, ts wpk.TagsetRaw) (err error) {
+			var fpath = util.JoinPath(srcpath, fkey)
 			var size = ts.Size()
 			num++
 			sum += size
@@ -140,20 +267,11 @@ func writepackage() (err error) {
 
 			// adjust tags
 			if PutMIME {
-				const sniffLen = 512
 				var ctype = mime.TypeByExtension(path.Ext(fkey))
 				if ctype == "" {
-					// rewind to file start
-					if _, err = file.Seek(0, io.SeekStart); err != nil {
-						return err
+					if ctype, err = sniffmime(fpath); err != nil {
+						return
 					}
-					// read a chunk to decide between utf-8 text and binary
-					var buf [sniffLen]byte
-					var n int64
-					if n, err = io.CopyN(bytes.NewBuffer(buf[:]), file, sniffLen); err != nil && err != io.EOF {
-						return err
-					}
-					ctype = http.DetectContentType(buf[:n])
 				}
 				if ctype != "" {
 					ts = ts.Put(wpk.TIDmime, wpk.StrTag(ctype))
@@ -163,9 +281,60 @@ func writepackage() (err error) {
 				ts = ts.Put(wpk.TIDlink, wpk.StrTag(fpath))
 			}
 			pkg.SetTagset(fkey, ts)
-			return nil
-		})
+
+			// put gzip variant if it's not present at source folder
+			if Variant {
+				var ctype, _ = ts.TagStr(wpk.TIDmime)
+				if ctype == "" {
+					ctype = mime.TypeByExtension(path.Ext(fkey))
+				}
+				if _, ok := keys[wpk.VariantKey(fkey, "gzip")]; !ok && wpk.IsCompressible(ctype) {
+					var data []byte
+					if data, err = os.ReadFile(fpath); err != nil {
+						return
+					}
+					var vts wpk.TagsetRaw
+					if vts, err = pkg.PackGzipVariant(w, data, fkey); err != nil {
+						return
+					}
+					if vts != nil {
+						vnum++
+					}
+				}
+			}
+			return
+		}
+		if Repro {
+			sort.SliceStable(list, func(i, j int) bool {
+				return list[i].Key < list[j].Key
+			})
+		}
+		if Jobs == 1 {
+			err = packlist(pkg, w, list, done)
+		} else {
+			err = pkg.PackParallel(w, list, wpk.ParallelOpts{Workers: Jobs}, done)
+		}
+		if err != nil {
+			return
+		}
 		log.Printf("packed: %d files on %d bytes", num, sum)
+
+		// link present pre-compressed files to its primary files
+		if Variant {
+			for _, src := range list {
+				for enc, suffix := range wpk.VariantSuffix {
+					if strings.HasSuffix(src.Key, suffix) && pkg.LinkVariant(strings.TrimSuffix(src.Key, suffix), enc) {
+						vnum++
+					}
+				}
+			}
+			log.Printf("variants: %d files", vnum)
+		}
+	}
+
+	if Dedup {
+		var num, saved = pkg.DedupStat()
+		log.Printf("deduplicated: %d files on %d bytes", num, saved)
 	}
 
 	// finalize
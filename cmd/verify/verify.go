@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/cmd/internal/pkgopt"
+	"github.com/schwarzlichtbezirk/wpk/util"
+)
+
+// command line settings
+var (
+	srcfile  string
+	trusthex string
+	SrcList  []string
+	Secret   string
+	PkgMode  string
+	ShowLog  bool
+	KeyHex   string
+	Key      []byte
+	Trusted  []ed25519.PublicKey
+)
+
+var (
+	ErrDataSize = errors.New("data file size does not match to header")
+	ErrOverlap  = errors.New("data range overlaps with other file")
+)
+
+func parseargs() {
+	flag.StringVar(&srcfile, "src", "", "package full file name, or list of files divided by ';'")
+	flag.StringVar(&Secret, "secret", "", "key to check up HMAC of MD5 and SHA digests")
+	flag.StringVar(&PkgMode, "pm", "bulk", "package opening mode, can be \"bulk\", \"mmap\" and \"fsys\"")
+	flag.BoolVar(&ShowLog, "sl", false, "show process log for each failed file")
+	flag.StringVar(&KeyHex, "key", "", "key in hexadecimal representation to decrypt files encrypted by AES-GCM")
+	flag.StringVar(&trusthex, "trust", "", "trusted Ed25519 public key in hexadecimal representation to verify package signature, or list of keys divided by ';'")
+	flag.Parse()
+}
+
+func checkargs() int {
+	var ec = 0 // error counter
+
+	for i, fpath := range strings.Split(srcfile, ";") {
+		if fpath == "" {
+			continue
+		}
+		fpath = util.ToSlash(util.Envfmt(fpath, nil))
+		if ok, _ := wpk.FileExists(fpath); !ok {
+			log.Printf("source file #%d '%s' does not exist", i+1, fpath)
+			ec++
+			continue
+		}
+		SrcList = append(SrcList, fpath)
+	}
+	if len(srcfile) == 0 {
+		log.Println("package file does not specified")
+		ec++
+	}
+
+	ec += pkgopt.CheckMode(PkgMode)
+
+	var n int
+	Key, n = pkgopt.ParseKey(KeyHex)
+	ec += n
+	Trusted, n = pkgopt.ParseTrusted(trusthex)
+	ec += n
+
+	return ec
+}
+
+// FileReport is verification report for file that does not pass it.
+type FileReport struct {
+	Key   string `json:"key"`
+	TID   uint16 `json:"tid,omitempty"`
+	Error string `json:"error"`
+}
+
+// PackageReport is verification report for one package.
+type PackageReport struct {
+	Path     string       `json:"path"`
+	DataPath string       `json:"datapath,omitempty"`
+	Count    int          `json:"count"`
+	FttSize  uint         `json:"fttsize"`
+	DataSize uint         `json:"datasize"`
+	Signed   bool         `json:"signed"`
+	Checked  int          `json:"checked"` // number of checked up hash tags
+	Error    string       `json:"error,omitempty"`
+	Failed   []FileReport `json:"failed,omitempty"`
+	OK       bool         `json:"ok"`
+}
+
+// Report is verification report for all packages.
+type Report struct {
+	Packages []*PackageReport `json:"packages"`
+	OK       bool             `json:"ok"`
+}
+
+func (pr *PackageReport) fail(fkey string, err error) {
+	var fr = FileReport{
+		Key:   fkey,
+		Error: err.Error(),
+	}
+	var et *wpk.ErrTag
+	if errors.As(err, &et) {
+		fr.TID = et.TID
+	}
+	pr.Failed = append(pr.Failed, fr)
+	if ShowLog {
+		log.Printf("failed: %s", err.Error())
+	}
+}
+
+// checkoverlaps finds files which data ranges overlaps, but they are not
+// aliases or members of same solid block, i.e. have not the same ranges.
+func checkoverlaps(pkg *wpk.Package, pr *PackageReport) {
+	type rng struct {
+		fkey         string
+		offset, size uint
+	}
+	var list []rng
+	pkg.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		if offset, size := ts.Pos(); size > 0 {
+			list = append(list, rng{fkey, offset, size})
+		}
+		return true
+	})
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].offset < list[j].offset
+	})
+	// index of range that has maximum end among passed ranges
+	var last = -1
+	for i, r := range list {
+		if last >= 0 {
+			var l = list[last]
+			if r.offset < l.offset+l.size && (r.offset != l.offset || r.size != l.size) {
+				pr.fail(r.fkey, &wpk.ErrTag{What: ErrOverlap, Key: l.fkey, TID: wpk.TIDoffset})
+			}
+		}
+		if last < 0 || r.offset+r.size > list[last].offset+list[last].size {
+			last = i
+		}
+	}
+}
+
+func verifypackage(pkgpath string) (pr *PackageReport) {
+	pr = &PackageReport{Path: pkgpath}
+	var err error
+	defer func() {
+		if err != nil {
+			pr.Error = err.Error()
+		}
+		pr.OK = err == nil && len(pr.Failed) == 0
+	}()
+
+	// check up header and files tags table
+	var hdr wpk.Header
+	var info wpk.TagsetRaw
+	if err = func() (err error) {
+		var r *os.File
+		if r, err = os.Open(pkgpath); err != nil {
+			return
+		}
+		defer r.Close()
+		hdr, info, err = wpk.GetPackageInfo(r)
+		return
+	}(); err != nil {
+		return
+	}
+	pr.Count, pr.FttSize, pr.DataSize = hdr.Count(), hdr.FttSize(), hdr.DataSize()
+	pr.Signed = info.Has(wpk.TIDsign)
+
+	var pkg = wpk.NewPackage()
+	pkg.SetTrusted(Trusted...)
+	var skipped int
+	pkg.SetTolerant(func(err error) {
+		var fkey string
+		var et *wpk.ErrTag
+		if errors.As(err, &et) {
+			fkey = et.Key
+		}
+		pr.fail(fkey, err)
+		skipped++
+	})
+	if err = pkg.OpenFile(pkgpath); err != nil {
+		return
+	}
+	if pkg.TagsetNum()+skipped != hdr.Count() {
+		err = wpk.ErrSignFTT
+		return
+	}
+
+	// check up data file size
+	var fpath = pkgpath
+	var datend = int64(wpk.HeaderSize + pkg.DataSize())
+	if pkg.IsSplitted() {
+		fpath = wpk.MakeDataPath(pkgpath)
+		pr.DataPath = fpath
+		datend = int64(pkg.DataSize())
+	}
+	var fi os.FileInfo
+	if fi, err = os.Stat(fpath); err != nil {
+		return
+	}
+	if fi.Size() < datend || (pkg.IsSplitted() && fi.Size() != datend) {
+		err = ErrDataSize
+		return
+	}
+
+	checkoverlaps(pkg, pr)
+
+	// check up files content
+	if pkg.Tagger, err = pkgopt.MakeTagger(PkgMode, fpath, Key); err != nil {
+		return
+	}
+	defer pkg.Close()
+
+	var res []wpk.VerifyResult
+	if res, err = pkg.Verify(context.Background(), []byte(Secret)); err != nil {
+		return
+	}
+	for _, vr := range res {
+		pr.Checked += vr.Checked
+		if vr.Err != nil {
+			pr.fail(vr.Key, vr.Err)
+		}
+	}
+	return
+}
+
+func main() {
+	parseargs()
+	if checkargs() > 0 {
+		os.Exit(2)
+	}
+
+	var report = Report{OK: true}
+	for _, pkgpath := range SrcList {
+		log.Printf("source package: %s", pkgpath)
+		var pr = verifypackage(pkgpath)
+		log.Printf("checked: %d files, %d hash tags, %d failed", pr.Count, pr.Checked, len(pr.Failed))
+		report.Packages = append(report.Packages, pr)
+		report.OK = report.OK && pr.OK
+	}
+
+	var enc = json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&report); err != nil {
+		log.Println(err.Error())
+		os.Exit(2)
+	}
+	if !report.OK {
+		os.Exit(1)
+	}
+}
+
+// The End.
@@ -0,0 +1,109 @@
+package wpk
+
+import (
+	"io"
+	"sort"
+)
+
+// segment is continuous range of package data used by one or more files.
+type segment struct {
+	offset, size uint
+	newoff       uint // offset of segment at compacted package
+}
+
+// Compact writes new package to given writers with only the data ranges
+// that are referred by tagsets, and rewrites offsets at all tagsets.
+// Whole table is compacted regardless of package workspace.
+// Data shared by aliases is written once. Data of source package is read
+// from 'src', that is package file, or data file for splitted package.
+// Writers should not refer to source files. Returns number of bytes
+// reclaimed from source package data. Signature of source package does not
+// match to rewritten offsets, so it's dropped, and compacted package is signed
+// only if signer was set by SetSigner before.
+func (pkg *Package) Compact(src io.ReaderAt, wpt, wpf io.WriteSeeker) (reclaimed int64, err error) {
+	var olddatsize = int64(pkg.DataSize())
+
+	// collect data ranges of whole table regardless of workspace,
+	// and merge overlapped ranges into segments
+	var segs []segment
+	pkg.rangeall(func(fkey string, ts TagsetRaw) bool {
+		if offset, size := ts.Pos(); size > 0 {
+			segs = append(segs, segment{offset: offset, size: size})
+		}
+		return true
+	})
+	sort.Slice(segs, func(i, j int) bool {
+		return segs[i].offset < segs[j].offset
+	})
+	var merged []segment
+	for _, s := range segs {
+		if n := len(merged); n > 0 && s.offset <= merged[n-1].offset+merged[n-1].size {
+			var last = &merged[n-1]
+			if end := s.offset + s.size; end > last.offset+last.size {
+				last.size = end - last.offset
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+
+	// starts new package
+	if err = pkg.Begin(wpt, wpf); err != nil {
+		return
+	}
+	var w = wpt
+	if wpf != nil && wpf != wpt {
+		w = wpf
+	}
+	var pos int64
+	if pos, err = w.Seek(int64(pkg.datoffset), io.SeekStart); err != nil {
+		return
+	}
+
+	// copy segments
+	for i := range merged {
+		var s = &merged[i]
+		s.newoff = uint(pos)
+		var n int64
+		if n, err = io.Copy(w, io.NewSectionReader(src, int64(s.offset), int64(s.size))); err != nil {
+			return
+		}
+		if n != int64(s.size) {
+			err = io.ErrUnexpectedEOF
+			return
+		}
+		pos += n
+	}
+
+	// rewrite offsets
+	pkg.mux.Lock()
+	var keys []string
+	var tslist []TagsetRaw
+	pkg.tsm.Range(func(fkey string, ts TagsetRaw) bool {
+		keys = append(keys, fkey)
+		tslist = append(tslist, ts)
+		return true
+	})
+	for i, ts := range tslist {
+		var offset, size = ts.Pos()
+		var newoff = uint(pkg.datoffset)
+		if size > 0 {
+			// find segment that contains the range
+			var j = sort.Search(len(merged), func(j int) bool {
+				return merged[j].offset+merged[j].size > offset
+			})
+			newoff = merged[j].newoff + offset - merged[j].offset
+		}
+		pkg.tsm.Poke(keys[i], CopyTagset(ts).Set(TIDoffset, UintTag(newoff)))
+	}
+	pkg.mux.Unlock()
+
+	// finalize
+	if err = pkg.Sync(wpt, wpf); err != nil {
+		return
+	}
+	reclaimed = olddatsize - int64(pkg.DataSize())
+	return
+}
+
+// The End.
@@ -0,0 +1,176 @@
+package wpk_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+)
+
+// Test package compaction to splitted package with files
+// deleted and replaced at source package.
+func TestCompact(t *testing.T) {
+	var err error
+	var fwpk, fwpt, fwpf *os.File
+	var tagsnum = 0
+	var pkg = wpk.NewPackage()
+
+	defer os.Remove(testpack)
+	defer os.Remove(testpkgt)
+	defer os.Remove(testpkgf)
+
+	var putfile = func(name string) {
+		var fpath = mediadir + name
+		var file *os.File
+		if file, err = os.Open(fpath); err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		var ts wpk.TagsetRaw
+		if ts, err = pkg.PackFile(fwpk, file, name); err != nil {
+			t.Fatal(err)
+		}
+		pkg.SetupTagset(ts.Put(wpk.TIDlink, wpk.StrTag(fpath)))
+		tagsnum++
+	}
+
+	// open temporary file for read/write
+	if fwpk, err = os.OpenFile(testpack, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	// starts new package
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	putfile("bounty.jpg")
+	putfile("img1/claustral.jpg")
+	putfile("img1/Qarataşlar.jpg")
+	putfile("img2/marble.jpg")
+	putfile("img2/Uzuncı.jpg")
+	for name, data := range memdata {
+		if _, err = pkg.PackData(fwpk, bytes.NewReader(data), name); err != nil {
+			t.Fatal(err)
+		}
+		tagsnum++
+	}
+	if err = pkg.PutAlias("img1/claustral.jpg", "jasper.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	tagsnum++
+	// delete files, and replace one file by other content
+	var garbage int64
+	for _, name := range []string{"bounty.jpg", "img2/marble.jpg", "sample.txt"} {
+		var ts, _ = pkg.DelTagset(name)
+		var _, size = ts.Pos()
+		garbage += int64(size)
+		tagsnum--
+	}
+	if _, err = pkg.PackData(fwpk, bytes.NewReader(memdata["sample.txt"]), "sample.txt"); err != nil {
+		t.Fatal(err)
+	}
+	tagsnum++
+	// finalize
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	var oldsize = pkg.DataSize()
+
+	// compact to splitted package
+	if fwpt, err = os.OpenFile(testpkgt, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpt.Close()
+	if fwpf, err = os.OpenFile(testpkgf, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpf.Close()
+
+	// compacted package is signed by given signer
+	var seed = bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	if err = pkg.SetSigner(seed); err != nil {
+		t.Fatal(err)
+	}
+
+	var reclaimed int64
+	if reclaimed, err = pkg.Compact(fwpk, fwpt, fwpf); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("data size %d bytes, compacted to %d bytes", oldsize, pkg.DataSize())
+	if reclaimed != garbage {
+		t.Fatalf("expected %d bytes reclaimed, got %d", garbage, reclaimed)
+	}
+	if int64(oldsize)-reclaimed != int64(pkg.DataSize()) {
+		t.Fatal("reclaimed size does not match to data size")
+	}
+
+	// make package file check up
+	CheckPackage(t, fwpt, fwpf, tagsnum)
+	var pub = ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	var cpkg = wpk.NewPackage()
+	cpkg.SetTrusted(pub)
+	if err = cpkg.OpenFile(testpkgt); err != nil {
+		t.Fatal(err)
+	}
+
+	var ts1, _ = pkg.GetTagset("img1/claustral.jpg")
+	var ts2, _ = pkg.GetTagset("jasper.jpg")
+	var off1, _ = ts1.Pos()
+	var off2, _ = ts2.Pos()
+	if off1 != off2 {
+		t.Fatal("alias data should be written once")
+	}
+}
+
+// Test compaction of package with workspace, that keeps
+// files out of workspace.
+func TestCompactWorkspace(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+	defer os.Remove(testpack2)
+	var files = map[string]string{
+		"dir/file1.txt": "content of first file",
+		"file2.txt":     "content of second file",
+	}
+	var pkg = packmap(t, testpack1, files)
+	pkg.Close()
+	pkg.Workspace = "dir"
+
+	var src, dst *os.File
+	if src, err = os.Open(testpack1); err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if dst, err = os.OpenFile(testpack2, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if _, err = pkg.Compact(src, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var cpkg = wpk.NewPackage()
+	if err = cpkg.OpenFile(testpack2); err != nil {
+		t.Fatal(err)
+	}
+	if cpkg.Tagger, err = bulk.MakeTagger(testpack2); err != nil {
+		t.Fatal(err)
+	}
+	defer cpkg.Close()
+	for fkey, content := range files {
+		var data []byte
+		if data, err = cpkg.ReadFile(fkey); err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Fatalf("wrong content of file '%s'", fkey)
+		}
+	}
+}
+
+// The End.
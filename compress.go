@@ -0,0 +1,295 @@
+package wpk
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Compression methods identifiers, stored at TIDcomp tag.
+const (
+	CompNone    byte = 0 // data is stored as is
+	CompDeflate byte = 1 // DEFLATE, RFC 1951
+)
+
+// ErrCompMethod is error on unknown compression method at tagset.
+var ErrCompMethod = errors.New("compression method is not supported")
+
+// Maximum ratio of original size to compressed size, DEFLATE can not exceed
+// 1032:1. Tagset with greater original size is treated as broken.
+const maxcompratio = 1032
+
+// CompSelector returns compression method for the file with given key.
+type CompSelector func(fkey string) byte
+
+// CompAll returns selector that applies given compression method for all files.
+func CompAll(method byte) CompSelector {
+	return func(string) byte {
+		return method
+	}
+}
+
+// CompByMIME returns selector that applies given compression method
+// only for files with compressible content type determined by file extension.
+func CompByMIME(method byte) CompSelector {
+	return func(fkey string) byte {
+		if IsCompressible(mime.TypeByExtension(path.Ext(fkey))) {
+			return method
+		}
+		return CompNone
+	}
+}
+
+// IsCompressible returns true for textual content types,
+// that has sense to compress.
+func IsCompressible(ctype string) bool {
+	if i := strings.IndexByte(ctype, ';'); i >= 0 {
+		ctype = ctype[:i]
+	}
+	ctype = strings.TrimSpace(ctype)
+	return strings.HasPrefix(ctype, "text/") ||
+		strings.HasSuffix(ctype, "json") ||
+		strings.HasSuffix(ctype, "javascript") ||
+		strings.HasSuffix(ctype, "xml")
+}
+
+// countWriter counts the number of bytes written through it.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return
+}
+
+// CompressTo writes data streamed by given reader compressed by given method.
+// Returns size of written compressed data and size of original data.
+func CompressTo(w io.Writer, r io.Reader, method byte) (size, fsize int64, err error) {
+	switch method {
+	case CompNone:
+		size, err = io.Copy(w, r)
+		fsize = size
+		return
+	case CompDeflate:
+		var cw = countWriter{w: w}
+		var fw *flate.Writer
+		if fw, err = flate.NewWriter(&cw, flate.DefaultCompression); err != nil {
+			return
+		}
+		if fsize, err = io.Copy(fw, r); err != nil {
+			return
+		}
+		if err = fw.Close(); err != nil {
+			return
+		}
+		size = cw.n
+		return
+	}
+	err = ErrCompMethod
+	return
+}
+
+// Decompressor returns reader that decompresses data from given reader
+// by given method.
+func Decompressor(r io.Reader, method byte) (io.ReadCloser, error) {
+	switch method {
+	case CompNone:
+		return io.NopCloser(r), nil
+	case CompDeflate:
+		return flate.NewReader(r), nil
+	}
+	return nil, ErrCompMethod
+}
+
+// MemFile structure gives access to nested into package file
+// which content was unpacked into memory.
+// RFile interface implementation.
+type MemFile struct {
+	*bytes.Reader
+	tags TagsetRaw // has fs.FileInfo interface
+}
+
+// NewMemFile creates MemFile file structure based on given content and tags slice.
+func NewMemFile(b []byte, ts TagsetRaw) *MemFile {
+	return &MemFile{
+		Reader: bytes.NewReader(b),
+		tags:   ts,
+	}
+}
+
+// Stat is for fs.File interface compatibility.
+func (f *MemFile) Stat() (fs.FileInfo, error) {
+	return f.tags, nil
+}
+
+// Close is for fs.File interface compatibility.
+func (f *MemFile) Close() error {
+	return nil
+}
+
+// UnpackFile returns file with decompressed content if given tagset points
+// to compressed data, or returns given file as is otherwise.
+// Content is decompressed by streaming on reading, so file is not
+// buffered in memory. Original size can not exceed compressed size by more
+// than maximum compression ratio. Given file is closed on closing of returned file.
+func UnpackFile(f RFile, ts TagsetRaw) (RFile, error) {
+	var method, ok = ts.TagByte(TIDcomp)
+	if !ok || method == CompNone {
+		return f, nil
+	}
+	if _, size := ts.Pos(); ts.Size() > int64(size)*maxcompratio+HeaderSize {
+		f.Close()
+		return nil, &ErrTag{ErrOutSize, ts.Path(), TIDfsize}
+	}
+	var dc, err = Decompressor(f, method)
+	if err != nil {
+		f.Close()
+		return nil, &ErrTag{err, ts.Path(), TIDcomp}
+	}
+	return &DecompFile{
+		f:      f,
+		dc:     dc,
+		method: method,
+		size:   ts.Size(),
+		tags:   ts,
+	}, nil
+}
+
+// DecompFile structure gives access to nested into package file
+// with compressed content, that is decompressed by streaming.
+// Seeking forward skips decompressed content, seeking backward
+// starts decompression from the beginning.
+// RFile interface implementation.
+type DecompFile struct {
+	f      RFile         // file with compressed content
+	dc     io.ReadCloser // decompressor of file content
+	method byte          // compression method
+	size   int64         // size of decompressed content
+	pos    int64         // offset of Read and Seek calls
+	spos   int64         // offset of decompressor stream
+	tags   TagsetRaw     // has fs.FileInfo interface
+	mux    sync.Mutex
+}
+
+// moveto moves decompressor stream to given offset.
+// Mutex should be locked by caller.
+func (f *DecompFile) moveto(off int64) (err error) {
+	if off < f.spos {
+		if _, err = f.f.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		f.dc.Close()
+		if f.dc, err = Decompressor(f.f, f.method); err != nil {
+			return
+		}
+		f.spos = 0
+	}
+	if off > f.size {
+		off = f.size
+	}
+	var n int64
+	n, err = io.CopyN(io.Discard, f.dc, off-f.spos)
+	f.spos += n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// read reads decompressed content at given offset.
+// Mutex should be locked by caller.
+func (f *DecompFile) read(b []byte, off int64) (n int, err error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	if err = f.moveto(off); err != nil {
+		return
+	}
+	if rest := f.size - off; int64(len(b)) > rest {
+		b = b[:rest]
+	}
+	n, err = f.dc.Read(b)
+	f.spos += int64(n)
+	if err == io.EOF {
+		if f.spos < f.size {
+			err = io.ErrUnexpectedEOF
+		} else {
+			err = nil
+		}
+	}
+	return
+}
+
+// Read reads decompressed content.
+// io.Reader implementation.
+func (f *DecompFile) Read(b []byte) (n int, err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	n, err = f.read(b, f.pos)
+	f.pos += int64(n)
+	return
+}
+
+// ReadAt reads decompressed content at given offset.
+// io.ReaderAt implementation.
+func (f *DecompFile) ReadAt(b []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, ErrOutOff
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for n < len(b) && err == nil {
+		var k int
+		k, err = f.read(b[n:], off+int64(n))
+		n += k
+	}
+	if n == len(b) {
+		err = nil
+	}
+	return
+}
+
+// Seek sets offset for next Read call.
+// io.Seeker implementation.
+func (f *DecompFile) Seek(offset int64, whence int) (abs int64, err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.pos + offset
+	case io.SeekEnd:
+		abs = f.size + offset
+	default:
+		return 0, fs.ErrInvalid
+	}
+	if abs < 0 {
+		return 0, ErrOutOff
+	}
+	f.pos = abs
+	return
+}
+
+// Stat is for fs.File interface compatibility.
+func (f *DecompFile) Stat() (fs.FileInfo, error) {
+	return f.tags, nil
+}
+
+// Close closes decompressor and file with compressed content.
+// io.Closer implementation.
+func (f *DecompFile) Close() error {
+	f.dc.Close()
+	return f.f.Close()
+}
+
+// The End.
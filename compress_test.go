@@ -0,0 +1,250 @@
+package wpk_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+	"github.com/schwarzlichtbezirk/wpk/fsys"
+	"github.com/schwarzlichtbezirk/wpk/mmap"
+)
+
+var compdata = map[string][]byte{
+	"text/lorem.txt":  []byte(strings.Repeat("Lorem ipsum dolor sit amet, consectetur adipiscing elit. ", 64)),
+	"text/data.json":  []byte(strings.Repeat(`{"key":"value","list":[1,2,3]},`, 64)),
+	"bin/array.dat":   memdata["array.dat"],
+	"text/sample.txt": memdata["sample.txt"],
+}
+
+// Test packing with compression, and reading of compressed files
+// by each tagger type.
+func TestCompress(t *testing.T) {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	defer os.Remove(testpack)
+
+	// open temporary file for read/write
+	if fwpk, err = os.OpenFile(testpack, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	// starts new package
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetCompress(wpk.CompByMIME(wpk.CompDeflate))
+	// put content
+	for name, data := range compdata {
+		var ts wpk.TagsetRaw
+		if ts, err = pkg.PackData(fwpk, bytes.NewReader(data), name); err != nil {
+			t.Fatal(err)
+		}
+		var _, size = ts.Pos()
+		t.Logf("put data '%s', %d bytes, stored %d bytes", name, ts.Size(), size)
+	}
+	// finalize
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// check up tags
+	for _, name := range []string{"text/lorem.txt", "text/data.json"} {
+		var ts, _ = pkg.GetTagset(name)
+		if method, _ := ts.TagByte(wpk.TIDcomp); method != wpk.CompDeflate {
+			t.Fatalf("file '%s' expected to be compressed", name)
+		}
+		if _, size := ts.Pos(); int64(size) >= ts.Size() {
+			t.Fatalf("compressed size of file '%s' is not less than original", name)
+		}
+	}
+	if ts, _ := pkg.GetTagset("bin/array.dat"); ts.Has(wpk.TIDcomp) {
+		t.Fatal("binary file should not be compressed")
+	}
+
+	for mode, maketagger := range map[string]func(string) (wpk.Tagger, error){
+		"bulk":  bulk.MakeTagger,
+		"mmap":  mmap.MakeTagger,
+		"whole": mmap.MakeWholeTagger,
+		"fsys":  fsys.MakeTagger,
+	} {
+		t.Run(mode, func(t *testing.T) {
+			var pkg = wpk.NewPackage()
+			if err = pkg.OpenFile(testpack); err != nil {
+				t.Fatal(err)
+			}
+			if pkg.Tagger, err = maketagger(testpack); err != nil {
+				t.Fatal(err)
+			}
+			defer pkg.Close()
+
+			for name, data := range compdata {
+				var b []byte
+				if b, err = pkg.ReadFile(name); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, data) {
+					t.Fatalf("content of '%s' is not equal to original", name)
+				}
+
+				var f, err = pkg.Open(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var fi, _ = f.Stat()
+				if fi.Size() != int64(len(data)) {
+					t.Fatalf("size of '%s' is %d, expected %d", name, fi.Size(), len(data))
+				}
+				var part = make([]byte, 10)
+				if _, err = f.(io.ReaderAt).ReadAt(part, 5); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(part, data[5:15]) {
+					t.Fatalf("random access read of '%s' gives wrong content", name)
+				}
+				// read again after seeking back
+				if _, err = f.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				if b, err = io.ReadAll(f); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, data) {
+					t.Fatalf("content of '%s' read after seek is not equal to original", name)
+				}
+				f.Close()
+			}
+
+			// original size of broken tagset exceeds compression ratio
+			var ts, _ = pkg.GetTagset("text/lorem.txt")
+			ts = wpk.CopyTagset(ts).Set(wpk.TIDfsize, wpk.UintTag(1<<40))
+			if _, err = pkg.Tagger.OpenTagset(ts); !errors.Is(err, wpk.ErrOutSize) {
+				t.Fatalf("expected error on too big original size, got %v", err)
+			}
+		})
+	}
+}
+
+// Test solid blocks packing, files access from solid blocks
+// by each tagger type, and access through sub-directory.
+func TestSolid(t *testing.T) {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	defer os.Remove(testpack)
+
+	var soliddata = map[string][]byte{}
+	var putdata = func(name string, data []byte) {
+		if _, err = pkg.PackData(fwpk, bytes.NewReader(data), name); err != nil {
+			t.Fatal(err)
+		}
+		soliddata[name] = data
+	}
+
+	// open temporary file for read/write
+	if fwpk, err = os.OpenFile(testpack, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	// starts new package
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetSolid(1024, 256)
+	// put content
+	for i := 0; i < 20; i++ {
+		putdata(fmt.Sprintf("json/item%02d.json", i), []byte(fmt.Sprintf(`{"id":%d,"name":"item #%d"}`, i, i)))
+	}
+	putdata("text/lorem.txt", compdata["text/lorem.txt"])
+	for i := 20; i < 30; i++ {
+		putdata(fmt.Sprintf("json/item%02d.json", i), []byte(fmt.Sprintf(`{"id":%d,"name":"item #%d"}`, i, i)))
+	}
+	if err = pkg.PutAlias("json/item25.json", "alias.json"); err != nil {
+		t.Fatal(err)
+	}
+	soliddata["alias.json"] = soliddata["json/item25.json"]
+	if _, ok := pkg.GetTagset("alias.json"); ok {
+		t.Fatal("file in unwritten solid block should not be readable")
+	}
+	if !pkg.HasTagset("alias.json") {
+		t.Fatal("file in unwritten solid block should be present")
+	}
+	// finalize
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pkg.GetTagset("alias.json"); !ok {
+		t.Fatal("file in written solid block should be readable")
+	}
+
+	// check up tags
+	if ts, _ := pkg.GetTagset("text/lorem.txt"); ts.Has(wpk.TIDblock) {
+		t.Fatal("big file should not be placed into solid block")
+	}
+	var ts1, _ = pkg.GetTagset("json/item00.json")
+	var ts2, _ = pkg.GetTagset("json/item25.json")
+	var ts3, _ = pkg.GetTagset("alias.json")
+	var blk1, _ = ts1.TagUint(wpk.TIDblock)
+	var blk2, _ = ts2.TagUint(wpk.TIDblock)
+	if blk1 == blk2 {
+		t.Fatal("files after big file should be placed into new solid block")
+	}
+	if off2, size2 := ts2.Pos(); size2 == 0 {
+		t.Fatal("solid block size was not updated")
+	} else if off3, size3 := ts3.Pos(); off2 != off3 || size2 != size3 {
+		t.Fatal("alias of file in solid block was not updated")
+	}
+
+	for mode, maketagger := range map[string]func(string) (wpk.Tagger, error){
+		"bulk":  bulk.MakeTagger,
+		"mmap":  mmap.MakeTagger,
+		"whole": mmap.MakeWholeTagger,
+		"fsys":  fsys.MakeTagger,
+	} {
+		t.Run(mode, func(t *testing.T) {
+			var pkg = wpk.NewPackage()
+			if err = pkg.OpenFile(testpack); err != nil {
+				t.Fatal(err)
+			}
+			if pkg.Tagger, err = maketagger(testpack); err != nil {
+				t.Fatal(err)
+			}
+			defer pkg.Close()
+
+			for name, data := range soliddata {
+				var b []byte
+				if b, err = pkg.ReadFile(name); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, data) {
+					t.Fatalf("content of '%s' is not equal to original", name)
+				}
+			}
+
+			var sub fs.FS
+			if sub, err = pkg.Sub("json"); err != nil {
+				t.Fatal(err)
+			}
+			var b []byte
+			if b, err = fs.ReadFile(sub, "item07.json"); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, soliddata["json/item07.json"]) {
+				t.Fatal("content of 'item07.json' at subdirectory is not equal to original")
+			}
+		})
+	}
+}
+
+// The End.
@@ -0,0 +1,128 @@
+package wpk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+)
+
+// dedupState is content-addressed deduplication state of package writer.
+type dedupState struct {
+	hashes map[[sha256.Size]byte]dedupRef // content digest to file with this content, nil turns off dedup
+	num    int                            // number of files that were not written due to deduplication
+	saved  int64                          // size of content that was not written
+}
+
+// dedupRef refers to packed file by full key, and keeps data placement
+// to check up that file was not deleted and replaced by other content.
+type dedupRef struct {
+	fkey   string
+	offset uint // offset of data, or solid block ID for file in solid block
+	blkoff uint // offset at unpacked solid block
+}
+
+// makeref returns reference to packed file with given tagset.
+func makeref(ts TagsetRaw) (ref dedupRef) {
+	ref.fkey = ts.Path()
+	if id, ok := ts.TagUint(TIDblock); ok {
+		ref.offset = id
+		ref.blkoff, _ = ts.TagUint(TIDblkoff)
+	} else {
+		ref.offset, _ = ts.TagUint(TIDoffset)
+		ref.blkoff = ^uint(0)
+	}
+	return
+}
+
+// SetDedup turns on or off content-addressed deduplication for new
+// packing files. With dedup, file with content identical to the file
+// already packed at this writing session refers to existing data instead
+// of writing it again. Data of non-seekable readers is buffered in memory
+// to compute its digest before writing.
+func (ftt *FTT) SetDedup(on bool) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	if !on {
+		ftt.dd.hashes = nil
+	} else if ftt.dd.hashes == nil {
+		ftt.dd.hashes = map[[sha256.Size]byte]dedupRef{}
+	}
+}
+
+// DedupStat returns number of deduplicated files, and size of their
+// content that was not written to package.
+func (ftt *FTT) DedupStat() (num int, saved int64) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	return ftt.dd.num, ftt.dd.saved
+}
+
+// dedupfind returns tagset of packed file with content of given digest.
+// Mutex should be locked by caller.
+func (ftt *FTT) dedupfind(sum [sha256.Size]byte) (ts TagsetRaw, ok bool) {
+	var ref dedupRef
+	if ref, ok = ftt.dd.hashes[sum]; !ok {
+		return
+	}
+	if ts, ok = ftt.tsm.Peek(ref.fkey); ok && makeref(ts) != ref {
+		ok = false
+	}
+	return
+}
+
+// dedupput remembers packed file with content of given digest.
+func (ftt *FTT) dedupput(sum [sha256.Size]byte, ts TagsetRaw) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	if ftt.dd.hashes != nil {
+		ftt.dd.hashes[sum] = makeref(ts)
+	}
+}
+
+// dedupdigest computes digest of content given by reader, and returns
+// reader to get the content again.
+func dedupdigest(r io.Reader) (sum [sha256.Size]byte, rr io.Reader, err error) {
+	var h = sha256.New()
+	if rs, ok := r.(io.ReadSeeker); ok {
+		var pos int64
+		if pos, err = rs.Seek(0, io.SeekCurrent); err != nil {
+			return
+		}
+		if _, err = io.Copy(h, rs); err != nil {
+			return
+		}
+		if _, err = rs.Seek(pos, io.SeekStart); err != nil {
+			return
+		}
+		rr = rs
+	} else {
+		var buf bytes.Buffer
+		if _, err = io.Copy(io.MultiWriter(h, &buf), r); err != nil {
+			return
+		}
+		rr = &buf
+	}
+	h.Sum(sum[:0])
+	return
+}
+
+// dedupts returns tagset for the file that refers to the data of file with
+// given original tagset. Mutex should be locked by caller.
+func (pkg *Package) dedupts(orig TagsetRaw, fkey string) (ts TagsetRaw) {
+	var offset, size = orig.Pos()
+	ts = pkg.BaseTagset(offset, size, fkey)
+	for _, tid := range []TID{TIDcomp, TIDfsize, TIDblock, TIDblkoff, TIDcipher, TIDnonce} {
+		if tag, ok := orig.Get(tid); ok {
+			ts = ts.Put(tid, tag)
+		}
+	}
+	// tagset should be updated when solid block under construction will be written
+	if id, ok := ts.TagUint(TIDblock); ok && id == pkg.blk.id && len(pkg.blk.buf) > 0 {
+		pkg.blk.keys = append(pkg.blk.keys, ts.Path())
+	}
+	pkg.dd.num++
+	pkg.dd.saved += ts.Size()
+	return
+}
+
+// The End.
@@ -0,0 +1,96 @@
+package wpk_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+)
+
+// Test content-addressed deduplication on packing, for regular files,
+// and for files in solid blocks.
+func TestDedup(t *testing.T) {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	defer os.Remove(testpack)
+
+	var jpeg []byte
+	if jpeg, err = os.ReadFile(mediadir + "bounty.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	var dedupdata = map[string][]byte{}
+	var putdata = func(name string, r io.Reader, data []byte) {
+		if _, err = pkg.PackData(fwpk, r, name); err != nil {
+			t.Fatal(err)
+		}
+		dedupdata[name] = data
+	}
+
+	// open temporary file for read/write
+	if fwpk, err = os.OpenFile(testpack, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	// starts new package
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetDedup(true)
+	pkg.SetSolid(1024, 256)
+	// seekable and non-seekable readers
+	putdata("img/bounty.jpg", bytes.NewReader(jpeg), jpeg)
+	putdata("img/copy1.jpg", bytes.NewReader(jpeg), jpeg)
+	putdata("img/copy2.jpg", io.MultiReader(bytes.NewReader(jpeg)), jpeg)
+	// small files at solid block
+	putdata("txt/sample.txt", bytes.NewReader(memdata["sample.txt"]), memdata["sample.txt"])
+	putdata("txt/array.dat", bytes.NewReader(memdata["array.dat"]), memdata["array.dat"])
+	putdata("txt/copy.txt", bytes.NewReader(memdata["sample.txt"]), memdata["sample.txt"])
+	// deleted file should not be referred
+	var other = []byte("other content")
+	putdata("txt/replaced.txt", bytes.NewReader(memdata["array.dat"]), memdata["array.dat"])
+	pkg.DelTagset("txt/array.dat")
+	delete(dedupdata, "txt/array.dat")
+	pkg.DelTagset("txt/replaced.txt")
+	putdata("txt/replaced.txt", bytes.NewReader(other), other)
+	putdata("txt/array2.dat", bytes.NewReader(memdata["array.dat"]), memdata["array.dat"])
+	// finalize
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var num, saved = pkg.DedupStat()
+	t.Logf("deduplicated %d files on %d bytes", num, saved)
+	if num != 4 || saved != int64(2*len(jpeg)+len(memdata["sample.txt"])+len(memdata["array.dat"])) {
+		t.Fatalf("wrong deduplication statistics: %d files on %d bytes", num, saved)
+	}
+	var ts1, _ = pkg.GetTagset("img/bounty.jpg")
+	var ts2, _ = pkg.GetTagset("img/copy2.jpg")
+	var off1, size1 = ts1.Pos()
+	var off2, size2 = ts2.Pos()
+	if off1 != off2 || size1 != size2 {
+		t.Fatal("identical files should refer to the same data")
+	}
+
+	// read content
+	if pkg.Tagger, err = bulk.MakeTagger(testpack); err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.Close()
+	for name, data := range dedupdata {
+		var b []byte
+		if b, err = pkg.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatalf("content of '%s' is not equal to original", name)
+		}
+	}
+}
+
+// The End.
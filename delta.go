@@ -0,0 +1,317 @@
+package wpk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+)
+
+// DeltaSign is signature at the start of binary delta.
+const DeltaSign = "WPKD"
+
+// Size of blocks of base content indexed to find matches at binary delta.
+const deltablock = 32
+
+// Rolling hash multiplier for blocks of binary delta.
+const deltaprime = 0x100000001b3
+
+// Instructions of binary delta.
+const (
+	deltaAdd  = 0 // append literal data
+	deltaCopy = 1 // copy range of base content
+)
+
+// Errors on binary delta.
+var (
+	ErrDelta     = errors.New("binary delta is broken")
+	ErrDeltaBase = errors.New("base file of binary delta is not found")
+)
+
+// deltahash returns rolling hash of given block.
+func deltahash(b []byte) (h uint64) {
+	for _, c := range b {
+		h = h*deltaprime + uint64(c)
+	}
+	return
+}
+
+// MakeDelta returns binary delta that makes target content from base content.
+// Delta is sequence of instructions to copy ranges of base content and to add
+// literal data, matches are found by rolling hash of base content blocks.
+func MakeDelta(base, target []byte) []byte {
+	var idx = map[uint64]int{}
+	for i := 0; i+deltablock <= len(base); i += deltablock {
+		var h = deltahash(base[i : i+deltablock])
+		if _, ok := idx[h]; !ok {
+			idx[h] = i
+		}
+	}
+	// highest power of multiplier in block hash
+	var pow uint64 = 1
+	for i := 1; i < deltablock; i++ {
+		pow *= deltaprime
+	}
+
+	var out bytes.Buffer
+	var num [binary.MaxVarintLen64]byte
+	var putuint = func(v int) {
+		out.Write(num[:binary.PutUvarint(num[:], uint64(v))])
+	}
+	var add = func(b []byte) {
+		if len(b) > 0 {
+			out.WriteByte(deltaAdd)
+			putuint(len(b))
+			out.Write(b)
+		}
+	}
+	out.WriteString(DeltaSign)
+	putuint(len(target))
+
+	var lit, i int // start of pending literal data, and current position
+	var h uint64
+	if len(target) >= deltablock {
+		h = deltahash(target[:deltablock])
+	}
+	for i+deltablock <= len(target) {
+		if off, ok := idx[h]; ok && bytes.Equal(base[off:off+deltablock], target[i:i+deltablock]) {
+			// extend match backward over pending literal data
+			for off > 0 && i > lit && base[off-1] == target[i-1] {
+				off--
+				i--
+			}
+			// extend match forward
+			var n = 0
+			for off+n < len(base) && i+n < len(target) && base[off+n] == target[i+n] {
+				n++
+			}
+			add(target[lit:i])
+			out.WriteByte(deltaCopy)
+			putuint(off)
+			putuint(n)
+			i += n
+			lit = i
+			if i+deltablock <= len(target) {
+				h = deltahash(target[i : i+deltablock])
+			}
+			continue
+		}
+		if i+deltablock < len(target) {
+			h = (h-uint64(target[i])*pow)*deltaprime + uint64(target[i+deltablock])
+		}
+		i++
+	}
+	add(target[lit:])
+	return out.Bytes()
+}
+
+// deltasize returns size of target content declared at binary delta header.
+func deltasize(delta []byte) (int, error) {
+	if !bytes.HasPrefix(delta, []byte(DeltaSign)) {
+		return 0, ErrDelta
+	}
+	var v, n = binary.Uvarint(delta[len(DeltaSign):])
+	if n <= 0 || v > math.MaxInt32 {
+		return 0, ErrDelta
+	}
+	return int(v), nil
+}
+
+// ApplyDelta returns target content made by given binary delta from base content.
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+	if !bytes.HasPrefix(delta, []byte(DeltaSign)) {
+		return nil, ErrDelta
+	}
+	var r = bytes.NewReader(delta[len(DeltaSign):])
+	var getuint = func() (int, error) {
+		var v, err = binary.ReadUvarint(r)
+		if err != nil || v > math.MaxInt32 {
+			return 0, ErrDelta
+		}
+		return int(v), nil
+	}
+	var size, err = getuint()
+	if err != nil {
+		return nil, err
+	}
+	var target []byte
+	for r.Len() > 0 {
+		var op, _ = r.ReadByte()
+		switch op {
+		case deltaAdd:
+			var n int
+			if n, err = getuint(); err != nil {
+				return nil, err
+			}
+			if n > r.Len() {
+				return nil, ErrDelta
+			}
+			var pos = len(delta) - r.Len()
+			target = append(target, delta[pos:pos+n]...)
+			r.Seek(int64(n), io.SeekCurrent)
+		case deltaCopy:
+			var off, n int
+			if off, err = getuint(); err != nil {
+				return nil, err
+			}
+			if n, err = getuint(); err != nil {
+				return nil, err
+			}
+			if off+n > len(base) {
+				return nil, ErrDelta
+			}
+			target = append(target, base[off:off+n]...)
+		default:
+			return nil, ErrDelta
+		}
+		if len(target) > size {
+			return nil, ErrDelta
+		}
+	}
+	if len(target) != size {
+		return nil, ErrDelta
+	}
+	return target, nil
+}
+
+// PackDelta puts into package binary delta that makes given content from
+// content of base file with given key. Tagset of packed file reports size
+// of reconstructed content, and refers to base file by key and SHA256 of
+// base content. Returns nil tagset if delta is not smaller than content,
+// in this case file is not packed.
+func (pkg *Package) PackDelta(w io.WriteSeeker, base, data []byte, fkey, basekey string) (ts TagsetRaw, err error) {
+	var delta = MakeDelta(base, data)
+	if len(delta) >= len(data) {
+		return
+	}
+	if ts, err = pkg.PackData(w, bytes.NewReader(delta), fkey); err != nil {
+		return
+	}
+	var sum = sha256.Sum256(base)
+	ts = CopyTagset(ts).
+		Set(TIDfsize, UintTag(uint(len(data)))).
+		Put(TIDdelta, StrTag(basekey)).
+		Put(TIDdeltasum, sum[:]).
+		Put(TIDdeltalen, UintTag(uint(len(delta))))
+	pkg.SetTagset(fkey, ts)
+	return
+}
+
+// DeltaTagger is Tagger decorator that reconstructs content of files packed
+// as binary deltas. Base file is looked up in packages of union, except
+// the package with this tagger, and it should have the same SHA256 of content
+// as it was at delta making. Other files are opened by nested tagger as is.
+type DeltaTagger struct {
+	Tagger
+	Union   *Union
+	Package *Package // package with this tagger, it's skipped at base lookup
+}
+
+// self reports whether given package of union is the package with this tagger.
+// Tagger of package can be wrapped by other decorators, so package is
+// recognized by its files tags table.
+func (dt *DeltaTagger) self(pkg *Package) bool {
+	if dt.Package != nil && pkg.FTT == dt.Package.FTT {
+		return true
+	}
+	return pkg.Tagger == Tagger(dt)
+}
+
+// OpenTagset returns file with reconstructed content for binary delta,
+// or opens file by nested tagger otherwise.
+// Tagger interface implementation.
+func (dt *DeltaTagger) OpenTagset(ts TagsetRaw) (RFile, error) {
+	var basekey, ok = ts.TagStr(TIDdelta)
+	if !ok {
+		return dt.Tagger.OpenTagset(ts)
+	}
+	var sum, _ = ts.Get(TIDdeltasum)
+	var dlen, _ = ts.TagUint(TIDdeltalen)
+
+	// delta size can not exceed stored data size unpacked
+	// with maximum compression ratio
+	var _, size = ts.Pos()
+	var limit = uint64(size)
+	if method, _ := ts.TagByte(TIDcomp); method != CompNone {
+		limit = limit*maxcompratio + HeaderSize
+	}
+	if uint64(dlen) > limit {
+		return nil, &ErrTag{ErrDelta, ts.Path(), TIDdeltalen}
+	}
+
+	// read binary delta, tagset gets size of delta content
+	var dts = CopyTagset(ts).Del(TIDdelta).Set(TIDfsize, UintTag(dlen))
+	var f, err = dt.Tagger.OpenTagset(dts)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var delta = make([]byte, dlen)
+	if _, err = io.ReadFull(f, delta); err != nil {
+		return nil, err
+	}
+	if tsize, err := deltasize(delta); err != nil || int64(tsize) != ts.Size() {
+		return nil, &ErrTag{ErrDelta, ts.Path(), TIDfsize}
+	}
+
+	// find base content
+	var base []byte
+	var found bool
+	if dt.Union != nil {
+		for _, pkg := range dt.Union.List {
+			if dt.self(pkg) {
+				continue
+			}
+			var bts, is = pkg.GetTagset(basekey)
+			if !is {
+				continue
+			}
+			var bf RFile
+			if bf, err = pkg.Tagger.OpenTagset(bts); err != nil {
+				return nil, err
+			}
+			var b []byte
+			b, err = io.ReadAll(bf)
+			bf.Close()
+			if err != nil {
+				return nil, err
+			}
+			if bsum := sha256.Sum256(b); bytes.Equal(bsum[:], sum) {
+				base, found = b, true
+				break
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "opendelta", Path: basekey, Err: ErrDeltaBase}
+	}
+
+	var data []byte
+	if data, err = ApplyDelta(base, delta); err != nil {
+		return nil, &ErrTag{err, ts.Path(), TIDdelta}
+	}
+	if int64(len(data)) != ts.Size() {
+		return nil, &ErrTag{ErrDelta, ts.Path(), TIDfsize}
+	}
+	return NewMemFile(data, ts), nil
+}
+
+// WrapDelta wraps taggers of all packages of union by DeltaTagger, so files
+// packed as binary deltas are reconstructed from base files placed at other
+// packages of union. Taggers already wrapped are left as is.
+func (u *Union) WrapDelta() {
+	for _, pkg := range u.List {
+		if pkg.Tagger == nil {
+			continue
+		}
+		if _, ok := pkg.Tagger.(*DeltaTagger); ok {
+			continue
+		}
+		pkg.Tagger = &DeltaTagger{Tagger: pkg.Tagger, Union: u, Package: pkg}
+	}
+}
+
+// The End.
@@ -0,0 +1,172 @@
+package wpk_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+)
+
+// modified returns copy of given content with some inserted,
+// deleted and overwritten bytes.
+func modified(base []byte) []byte {
+	var b = append([]byte{}, base[:1000]...)
+	b = append(b, "inserted content"...)
+	b = append(b, base[1000:5000]...)
+	b = append(b, base[6000:]...) // deleted range
+	copy(b[20000:], "overwritten content")
+	return append(b, "appended content"...)
+}
+
+// Test making and applying of binary delta.
+func TestMakeDelta(t *testing.T) {
+	var r = rand.New(rand.NewSource(1))
+	var base = make([]byte, 64*1024)
+	r.Read(base)
+	var target = modified(base)
+
+	var delta = wpk.MakeDelta(base, target)
+	if len(delta) > 1024 {
+		t.Fatalf("delta size is %d bytes, expected less than 1024 bytes", len(delta))
+	}
+	var b, err = wpk.ApplyDelta(base, delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, target) {
+		t.Fatal("content made by delta is not equal to target")
+	}
+
+	// edge cases
+	for _, c := range [][2][]byte{
+		{nil, nil},
+		{nil, []byte("target without base")},
+		{[]byte("base without target"), nil},
+		{base[:10], base[:20]},
+	} {
+		if b, err = wpk.ApplyDelta(c[0], wpk.MakeDelta(c[0], c[1])); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, c[1]) {
+			t.Fatal("content made by delta is not equal to target")
+		}
+	}
+	if _, err = wpk.ApplyDelta(base[:1000], delta); err == nil {
+		t.Fatal("delta is applied to wrong base")
+	}
+	if _, err = wpk.ApplyDelta(base, delta[:len(delta)-1]); err == nil {
+		t.Fatal("truncated delta is applied")
+	}
+}
+
+// Test patch package with binary deltas opened by DeltaTagger.
+func TestDeltaTagger(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+	defer os.Remove(testpack2)
+	defer os.Remove(testpatch)
+
+	var r = rand.New(rand.NewSource(2))
+	var base = make([]byte, 64*1024)
+	r.Read(base)
+	var target = modified(base)
+
+	var oldpkg = packmap(t, testpack1, map[string]string{
+		"level.bin": string(base),
+		"small.txt": "old",
+	})
+	defer oldpkg.Close()
+	var newpkg = packmap(t, testpack2, map[string]string{
+		"level.bin": string(target),
+		"small.txt": "new",
+	})
+	defer newpkg.Close()
+
+	// make patch package
+	var fwpk *os.File
+	var patch = wpk.NewPackage()
+	if fwpk, err = os.OpenFile(testpatch, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+	if err = patch.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	patch.SetCompress(wpk.CompAll(wpk.CompDeflate))
+	if _, err = patch.PackDeltaDiff(fwpk, newpkg, oldpkg); err != nil {
+		t.Fatal(err)
+	}
+	if err = patch.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if size := patch.DataSize(); size > 2048 {
+		t.Fatalf("patch data size is %d bytes, expected less than 2048 bytes", size)
+	}
+
+	// open patch with plain tagger
+	patch = wpk.NewPackage()
+	if err = patch.OpenFile(testpatch); err != nil {
+		t.Fatal(err)
+	}
+	if patch.Tagger, err = bulk.MakeTagger(testpatch); err != nil {
+		t.Fatal(err)
+	}
+	defer patch.Close()
+	if _, err = patch.ReadFile("level.bin"); !errors.Is(err, wpk.ErrDeltaBase) {
+		t.Fatalf("expected error on delta file opened by plain tagger, got %v", err)
+	}
+
+	// wrap tagger by delta tagger, and then by other decorator
+	var u = &wpk.Union{List: []*wpk.Package{patch}}
+	u.WrapDelta()
+	patch.Tagger = wpk.NewCacheTagger(patch.Tagger, 1<<20)
+
+	var ts, _ = patch.GetTagset("level.bin")
+	if !ts.Has(wpk.TIDdelta) {
+		t.Fatal("changed file is not packed as delta")
+	}
+	if ts.Size() != int64(len(target)) {
+		t.Fatalf("size of delta file is %d, expected %d", ts.Size(), len(target))
+	}
+	if ts, _ = patch.GetTagset("small.txt"); ts.Has(wpk.TIDdelta) {
+		t.Fatal("file with delta greater than content is packed as delta")
+	}
+
+	// base package is absent at union
+	if _, err = u.ReadFile("level.bin"); !errors.Is(err, wpk.ErrDeltaBase) {
+		t.Fatalf("expected error on delta file without base package, got %v", err)
+	}
+
+	u.List = []*wpk.Package{patch, oldpkg}
+	var b []byte
+	if b, err = u.ReadFile("level.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, target) {
+		t.Fatal("content of delta file is not equal to new version")
+	}
+	if b, err = u.ReadFile("small.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "new" {
+		t.Fatal("content of changed file is not equal to new version")
+	}
+
+	// broken tagsets are refused before content allocation
+	var dt = patch.Tagger.(*wpk.CacheTagger).Tagger
+	ts, _ = patch.GetTagset("level.bin")
+	for name, bad := range map[string]wpk.TagsetRaw{
+		"deltalen": wpk.CopyTagset(ts).Set(wpk.TIDdeltalen, wpk.UintTag(1<<62)),
+		"fsize":    wpk.CopyTagset(ts).Set(wpk.TIDfsize, wpk.UintTag(uint(len(target)+1))),
+	} {
+		if _, err = dt.OpenTagset(bad); !errors.Is(err, wpk.ErrDelta) {
+			t.Fatalf("expected error on broken %s tag, got %v", name, err)
+		}
+	}
+}
+
+// The End.
@@ -0,0 +1,253 @@
+package wpk
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/schwarzlichtbezirk/wpk/util"
+)
+
+// ErrDelList is error on list of deleted files that does not fit into info tag.
+var ErrDelList = errors.New("list of deleted files is too long")
+
+// datatids is set of tags IDs that describe placement of file data
+// in package, they are not copied to other package with file.
+var datatids = map[TID]Void{
+	TIDoffset: {}, TIDsize: {}, TIDpath: {},
+	TIDcomp: {}, TIDfsize: {}, TIDblock: {}, TIDblkoff: {},
+	TIDcipher: {}, TIDnonce: {},
+	TIDdelta: {}, TIDdeltasum: {}, TIDdeltalen: {},
+}
+
+// Diff is result of comparison of two packages.
+type Diff struct {
+	Added   []string // files present only at new package
+	Changed []string // files with different content
+	Deleted []string // files present only at old package
+}
+
+// samefile compares content of files with given tagsets. Files are equal
+// if they have equal sizes and equal the strongest cryptographic digest
+// present at both tagsets. Digests are HMAC with secrets that can differ
+// for two packages, and CRC checksums can collide, so in any other case
+// files are compared by content.
+func samefile(pkg1, pkg2 *Package, ts1, ts2 TagsetRaw) (bool, error) {
+	if ts1.Size() != ts2.Size() {
+		return false, nil
+	}
+	for i := len(HashTIDs) - 1; i >= 0 && IsDigestTID(HashTIDs[i]); i-- {
+		var tag1, ok1 = ts1.Get(HashTIDs[i])
+		var tag2, ok2 = ts2.Get(HashTIDs[i])
+		if ok1 && ok2 {
+			if bytes.Equal(tag1, tag2) {
+				return true, nil
+			}
+			break
+		}
+	}
+
+	var f1, f2 RFile
+	var err error
+	if f1, err = pkg1.Tagger.OpenTagset(ts1); err != nil {
+		return false, err
+	}
+	defer f1.Close()
+	if f2, err = pkg2.Tagger.OpenTagset(ts2); err != nil {
+		return false, err
+	}
+	defer f2.Close()
+
+	const chunk = 64 * 1024
+	var buf1, buf2 = make([]byte, chunk), make([]byte, chunk)
+	for {
+		var n1, err1 = io.ReadFull(f1, buf1)
+		var n2, err2 = io.ReadFull(f2, buf2)
+		if err1 != nil && err1 != io.EOF && err1 != io.ErrUnexpectedEOF {
+			return false, err1
+		}
+		if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
+			return false, err2
+		}
+		if !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+		if err1 != nil || err2 != nil {
+			return err1 != nil && err2 != nil, nil
+		}
+	}
+}
+
+// DiffPackages compares files of new package with files of old package by keys,
+// and content of files with the same keys by equal cryptographic digests,
+// or by content itself otherwise. Packages should have opened taggers.
+func DiffPackages(newpkg, oldpkg *Package) (d Diff, err error) {
+	newpkg.Enum(func(fkey string, nts TagsetRaw) bool {
+		var ots, ok = oldpkg.GetTagset(fkey)
+		if !ok {
+			d.Added = append(d.Added, fkey)
+			return true
+		}
+		var same bool
+		if same, err = samefile(newpkg, oldpkg, nts, ots); err != nil {
+			return false
+		}
+		if !same {
+			d.Changed = append(d.Changed, fkey)
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	oldpkg.Enum(func(fkey string, ots TagsetRaw) bool {
+		if !newpkg.HasTagset(fkey) {
+			d.Deleted = append(d.Deleted, fkey)
+		}
+		return true
+	})
+	return
+}
+
+// PackDiff puts into package added and changed files of new package
+// comparing to old package with all their tags, and list of deleted files
+// to package info. Package placed first at union list above old package
+// with honoured lists of deleted files reproduces new package.
+// Package should be started by Begin and finalized by Sync by caller.
+func (pkg *Package) PackDiff(w io.WriteSeeker, newpkg, oldpkg *Package) (Diff, error) {
+	return pkg.packdiff(w, newpkg, oldpkg, false)
+}
+
+// PackDeltaDiff makes the same patch as PackDiff, but changed files are
+// packed as binary deltas against files of old package, if delta is smaller
+// than file. Files of such patch should be opened by DeltaTagger with
+// union, that contains old package.
+func (pkg *Package) PackDeltaDiff(w io.WriteSeeker, newpkg, oldpkg *Package) (Diff, error) {
+	return pkg.packdiff(w, newpkg, oldpkg, true)
+}
+
+// readtagset returns content of file with given tagset.
+func (pkg *Package) readtagset(ts TagsetRaw) (b []byte, err error) {
+	var f RFile
+	if f, err = pkg.Tagger.OpenTagset(ts); err != nil {
+		return
+	}
+	defer f.Close()
+	b = make([]byte, ts.Size())
+	_, err = io.ReadFull(f, b)
+	return
+}
+
+// packdiff makes patch package, changed files are packed
+// as binary deltas if 'delta' is true.
+func (pkg *Package) packdiff(w io.WriteSeeker, newpkg, oldpkg *Package, delta bool) (d Diff, err error) {
+	if d, err = DiffPackages(newpkg, oldpkg); err != nil {
+		return
+	}
+
+	var put = func(fkey string, changed bool) (err error) {
+		var nts, _ = newpkg.GetTagset(fkey)
+		var ts TagsetRaw
+		if changed && delta {
+			var ots, _ = oldpkg.GetTagset(fkey)
+			var data, base []byte
+			if data, err = newpkg.readtagset(nts); err != nil {
+				return
+			}
+			if base, err = oldpkg.readtagset(ots); err != nil {
+				return
+			}
+			if ts, err = pkg.PackDelta(w, base, data, fkey, fkey); err != nil {
+				return
+			}
+			if ts == nil { // delta is not smaller than file
+				if ts, err = pkg.PackData(w, bytes.NewReader(data), fkey); err != nil {
+					return
+				}
+			}
+		} else {
+			var f RFile
+			if f, err = newpkg.Tagger.OpenTagset(nts); err != nil {
+				return
+			}
+			defer f.Close()
+			if ts, err = pkg.PackData(w, f, fkey); err != nil {
+				return
+			}
+		}
+		var tsi = nts.Iterator()
+		for tsi.Next() {
+			if _, ok := datatids[tsi.TID()]; !ok {
+				ts = ts.Set(tsi.TID(), tsi.Tag())
+			}
+		}
+		pkg.SetTagset(fkey, ts)
+		return
+	}
+	for _, fkey := range d.Added {
+		if err = put(fkey, false); err != nil {
+			return
+		}
+	}
+	for _, fkey := range d.Changed {
+		if err = put(fkey, true); err != nil {
+			return
+		}
+	}
+
+	if len(d.Deleted) > 0 {
+		var info = CopyTagset(pkg.GetInfo()).
+			Set(TIDdellist, StrTag(strings.Join(d.Deleted, "\n")))
+		if len(info) > tsmaxlen {
+			err = ErrDelList
+			return
+		}
+		pkg.SetInfo(info)
+	}
+	return
+}
+
+// delCache is set of deleted files keys parsed from package info.
+type delCache struct {
+	list string          // list of deleted files the set was parsed from
+	set  map[string]Void // keys of deleted files
+	mux  sync.Mutex
+}
+
+// delset returns set of deleted files keys from package info.
+// List is parsed once, and parsed again only if info was changed.
+func (ftt *FTT) delset() map[string]Void {
+	var list, _ = ftt.GetInfo().TagStr(TIDdellist)
+	ftt.dl.mux.Lock()
+	defer ftt.dl.mux.Unlock()
+	if ftt.dl.set == nil || ftt.dl.list != list {
+		var set = map[string]Void{}
+		if list != "" {
+			for _, fkey := range strings.Split(list, "\n") {
+				set[fkey] = Void{}
+			}
+		}
+		ftt.dl.list, ftt.dl.set = strings.Clone(list), set
+	}
+	return ftt.dl.set
+}
+
+// DelList returns list of deleted files keys from package info.
+func (pkg *Package) DelList() []string {
+	var list, ok = pkg.GetInfo().TagStr(TIDdellist)
+	if !ok || list == "" {
+		return nil
+	}
+	return strings.Split(list, "\n")
+}
+
+// IsDeleted returns true if file with given key
+// is present at list of deleted files of package.
+func (pkg *Package) IsDeleted(fkey string) bool {
+	var _, ok = pkg.delset()[pkg.FullPath(util.ToSlash(fkey))]
+	return ok
+}
+
+// The End.
@@ -0,0 +1,207 @@
+package wpk_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+	"github.com/schwarzlichtbezirk/wpk/wpkhttp"
+)
+
+// packmap makes package with given files content and opens it.
+// Files with names started with "h" get SHA256 hash tag.
+func packmap(t *testing.T, wpkname string, files map[string]string) *wpk.Package {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	if fwpk, err = os.OpenFile(wpkname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for fkey := range files {
+		keys = append(keys, fkey)
+	}
+	sort.Strings(keys)
+	for _, fkey := range keys {
+		var ts wpk.TagsetRaw
+		if ts, err = pkg.PackData(fwpk, bytes.NewReader([]byte(files[fkey])), fkey); err != nil {
+			t.Fatal(err)
+		}
+		ts = ts.Put(wpk.TIDmime, wpk.StrTag("text/plain"))
+		if fkey[0] == 'h' {
+			var sum = sha256.Sum256([]byte(files[fkey]))
+			ts = ts.Put(wpk.TIDsha256, sum[:])
+		}
+		pkg.SetTagset(fkey, ts)
+	}
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg = wpk.NewPackage()
+	if err = pkg.OpenFile(wpkname); err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Tagger, err = bulk.MakeTagger(wpkname); err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+// Test patch package made as difference between two packages,
+// and union of patch and old package that gives new package.
+func TestDiff(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+	defer os.Remove(testpack2)
+	defer os.Remove(testpatch)
+
+	var oldpkg = packmap(t, testpack1, map[string]string{
+		"same.txt":       "same content",
+		"size.txt":       "old content",
+		"data/bytes.txt": "aaaa",
+		"hash.txt":       "old hashed",
+		"data/del.txt":   "deleted file",
+		"gone.txt":       "deleted file",
+		"crc.txt":        "old checksum",
+		"keyed.txt":      "same content",
+	})
+	defer oldpkg.Close()
+	var newpkg = packmap(t, testpack2, map[string]string{
+		"same.txt":       "same content",
+		"size.txt":       "new longer content",
+		"data/bytes.txt": "bbbb",
+		"hash.txt":       "new hashed",
+		"data/add.txt":   "added file",
+		"crc.txt":        "new checksum",
+		"keyed.txt":      "same content",
+	})
+	defer newpkg.Close()
+	// checksums collide for different content, and digests
+	// made with different secrets differ for the same content
+	for i, pkg := range []*wpk.Package{oldpkg, newpkg} {
+		var ts, _ = pkg.GetTagset("crc.txt")
+		pkg.SetTagset("crc.txt", wpk.CopyTagset(ts).Put(wpk.TIDcrc32ieee, []byte{1, 2, 3, 4}))
+		ts, _ = pkg.GetTagset("keyed.txt")
+		pkg.SetTagset("keyed.txt", wpk.CopyTagset(ts).Put(wpk.TIDsha256, bytes.Repeat([]byte{byte(i)}, 32)))
+	}
+
+	// make patch package
+	var fwpk *os.File
+	var patch = wpk.NewPackage()
+	if fwpk, err = os.OpenFile(testpatch, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+	if err = patch.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	var d wpk.Diff
+	if d, err = patch.PackDiff(fwpk, newpkg, oldpkg); err != nil {
+		t.Fatal(err)
+	}
+	if err = patch.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	var check = func(what string, list []string, expect ...string) {
+		sort.Strings(list)
+		sort.Strings(expect)
+		if len(list) != len(expect) {
+			t.Fatalf("%s files: expected %v, got %v", what, expect, list)
+		}
+		for i := range list {
+			if list[i] != expect[i] {
+				t.Fatalf("%s files: expected %v, got %v", what, expect, list)
+			}
+		}
+	}
+	check("added", d.Added, "data/add.txt")
+	check("changed", d.Changed, "size.txt", "data/bytes.txt", "hash.txt", "crc.txt")
+	check("deleted", d.Deleted, "data/del.txt", "gone.txt")
+
+	// open patch and make union with old package
+	patch = wpk.NewPackage()
+	if err = patch.OpenFile(testpatch); err != nil {
+		t.Fatal(err)
+	}
+	if patch.Tagger, err = bulk.MakeTagger(testpatch); err != nil {
+		t.Fatal(err)
+	}
+	defer patch.Close()
+	check("listed deleted", patch.DelList(), "data/del.txt", "gone.txt")
+	if ts, _ := patch.GetTagset("size.txt"); !ts.Has(wpk.TIDmime) {
+		t.Fatal("tags of changed file are not copied to patch")
+	}
+
+	var u = &wpk.Union{List: []*wpk.Package{patch, oldpkg}}
+	if _, err = u.Stat("gone.txt"); err != nil {
+		t.Fatal("deleted file should be found without honoured lists of deleted files")
+	}
+	u.DelList = true
+	var keys []string
+	newpkg.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		keys = append(keys, fkey)
+		return true
+	})
+	check("union", u.AllKeys(), keys...)
+	for _, fkey := range keys {
+		var b1, b2 []byte
+		if b1, err = newpkg.ReadFile(fkey); err != nil {
+			t.Fatal(err)
+		}
+		if b2, err = u.ReadFile(fkey); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b1, b2) {
+			t.Fatalf("content of '%s' at union is not equal to new package", fkey)
+		}
+	}
+	if _, err = u.Stat("gone.txt"); err == nil {
+		t.Fatal("deleted file is found at union")
+	}
+	var list, _ = u.ReadDir("data")
+	if len(list) != 2 {
+		t.Fatalf("expected 2 entries at 'data' directory of union, got %d", len(list))
+	}
+
+	// subdirectory of union honours lists of deleted files
+	var sub fs.FS
+	if sub, err = u.Sub("data"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fs.Stat(sub, "del.txt"); err == nil {
+		t.Fatal("deleted file is found at union subdirectory")
+	}
+	if _, err = fs.Stat(sub, "add.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// HTTP handler honours lists of deleted files
+	var h = wpkhttp.NewUnionHandler(u)
+	for fkey, code := range map[string]int{
+		"gone.txt":     http.StatusNotFound,
+		"data/del.txt": http.StatusNotFound,
+		"data/add.txt": http.StatusOK,
+	} {
+		var rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+fkey, nil))
+		if rec.Code != code {
+			t.Fatalf("expected status %d for '%s', got %d", code, fkey, rec.Code)
+		}
+	}
+}
+
+// The End.
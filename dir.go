@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/schwarzlichtbezirk/wpk/util"
@@ -25,11 +26,59 @@ func MakeDataPath(fpath string) string {
 	return fpath[:len(fpath)-len(ext)] + ".wpf"
 }
 
+// validpath reports whether given name is valid path for fs.FS methods.
+// In addition to fs.ValidPath rules, names with backslashes are rejected,
+// since backslashes are converted to slashes at files keys.
+func validpath(name string) bool {
+	return fs.ValidPath(name) && !strings.ContainsRune(name, '\\')
+}
+
+// dirpager keeps position of successive reading of directory entries
+// by fs.ReadDirFile.ReadDir calls.
+type dirpager struct {
+	list []fs.DirEntry // sorted entries of directory
+	pos  int           // position of next entry to read
+	read bool          // entries are read
+}
+
+// next returns next page of directory entries according fs.ReadDirFile
+// contract. Entries are got by given function at first call.
+func (p *dirpager) next(n int, readdir func() ([]fs.DirEntry, error)) ([]fs.DirEntry, error) {
+	if !p.read {
+		var list, err = readdir()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		p.list, p.read = list, true
+	}
+	var rest = p.list[p.pos:]
+	if n <= 0 {
+		p.pos = len(p.list)
+		return append([]fs.DirEntry{}, rest...), nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	p.pos += n
+	return rest[:n:n], nil
+}
+
+// sortdir sorts directory entries by name.
+func sortdir(list []fs.DirEntry) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+}
+
 // PackDirFile is a directory file whose entries can be read with the ReadDir method.
 // fs.ReadDirFile interface implementation.
 type PackDirFile struct {
 	TagsetRaw // has fs.FileInfo interface
 	ftt       *FTT
+	pager     dirpager
 }
 
 // fs.ReadDirFile interface implementation.
@@ -47,9 +96,13 @@ func (f *PackDirFile) Close() error {
 	return nil
 }
 
+// ReadDir reads the directory entries sorted by name. Successive calls
+// returns next entries after the previous ones.
 // fs.ReadDirFile interface implementation.
-func (f *PackDirFile) ReadDir(n int) (matches []fs.DirEntry, err error) {
-	return f.ftt.ReadDirN(f.Path(), n)
+func (f *PackDirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	return f.pager.next(n, func() ([]fs.DirEntry, error) {
+		return f.ftt.ReadDirN(f.Path(), -1)
+	})
 }
 
 // DirExists check up directory existence.
@@ -81,78 +134,57 @@ func TempPath(fname string) string {
 	return util.JoinPath(util.ToSlash(os.TempDir()), fname)
 }
 
-// ReadDirN returns fs.DirEntry array with nested into given package directory presentation.
-// It's core function for ReadDirFile and ReadDirFS structures.
+// ReadDirN returns fs.DirEntry array with nested into given package directory
+// presentation sorted by name. If n > 0, returns at most n first entries, and
+// io.EOF if there are no more entries. It's core function for ReadDirFile
+// and ReadDirFS structures.
 func (ftt *FTT) ReadDirN(fulldir string, n int) (list []fs.DirEntry, err error) {
 	fulldir = util.ToSlash(fulldir)
-	var found = map[string]fs.DirEntry{}
-	var prefix string
-	if fulldir != "." && fulldir != "" {
-		prefix = fulldir + "/" // set terminated slash
-	}
-
-	ftt.tsm.Range(func(fkey string, ts TagsetRaw) bool {
-		if strings.HasPrefix(fkey, prefix) {
-			var suffix = fkey[len(prefix):]
-			var sp = strings.IndexByte(suffix, '/')
-			if sp < 0 { // file detected
-				found[suffix] = ts
-				n--
-			} else { // dir detected
-				var subdir = util.JoinPath(prefix, suffix[:sp])
-				if _, ok := found[subdir]; !ok {
-					var dts = TagsetRaw{}.
-						Put(TIDpath, StrTag(subdir))
-					var f = &PackDirFile{
-						TagsetRaw: dts,
-						ftt:       ftt,
-					}
-					found[subdir] = f
-					n--
-				}
-			}
+	var files, dirs = ftt.dirindex().list(fulldir)
+	list = make([]fs.DirEntry, 0, len(files)+len(dirs))
+	for _, name := range files {
+		if ts, ok := ftt.peek(util.JoinPath(fulldir, name)); ok {
+			list = append(list, ts)
 		}
-		return n != 0
-	})
-
-	list = make([]fs.DirEntry, len(found))
-	var i int
-	for _, de := range found {
-		list[i] = de
-		i++
 	}
+	for _, name := range dirs {
+		var dts = TagsetRaw{}.
+			Put(TIDpath, StrTag(util.JoinPath(fulldir, name)))
+		list = append(list, &PackDirFile{
+			TagsetRaw: dts,
+			ftt:       ftt,
+		})
+	}
+
+	sortdir(list)
 	if n > 0 {
-		err = io.EOF
+		if len(list) > n {
+			list = list[:n]
+		} else if len(list) < n {
+			err = io.EOF
+		}
 	}
 	return
 }
 
+// HasDir checks up that directory with given full path is present at package.
+func (ftt *FTT) HasDir(fulldir string) bool {
+	return ftt.dirindex().has(util.ToSlash(fulldir))
+}
+
 // OpenDir returns PackDirFile structure associated with group of files in package
 // pooled with common directory prefix. Usable to implement fs.FileSystem interface.
 func (ftt *FTT) OpenDir(fulldir string) (fs.ReadDirFile, error) {
 	fulldir = util.ToSlash(fulldir)
-	var prefix string
-	if fulldir != "." && fulldir != "" {
-		prefix = fulldir + "/" // set terminated slash
-	}
-	var f *PackDirFile
-	ftt.tsm.Range(func(fkey string, ts TagsetRaw) bool {
-		if strings.HasPrefix(fkey, prefix) {
-			var dts = TagsetRaw{}.
-				Put(TIDpath, StrTag(fulldir))
-			f = &PackDirFile{
-				TagsetRaw: dts,
-				ftt:       ftt,
-			}
-			return false
-		}
-		return true
-	})
-	if f != nil {
-		return f, nil
+	if !ftt.dirindex().has(fulldir) { // on case if not found
+		return nil, &fs.PathError{Op: "open", Path: fulldir, Err: fs.ErrNotExist}
 	}
-	// on case if not found
-	return nil, &fs.PathError{Op: "open", Path: fulldir, Err: fs.ErrNotExist}
+	var dts = TagsetRaw{}.
+		Put(TIDpath, StrTag(fulldir))
+	return &PackDirFile{
+		TagsetRaw: dts,
+		ftt:       ftt,
+	}, nil
 }
 
 // The End.
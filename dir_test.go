@@ -0,0 +1,105 @@
+package wpk_test
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+)
+
+// openpack opens package with bulk tagger.
+func openpack(t *testing.T, wpkname string) *wpk.Package {
+	var err error
+	var pkg = wpk.NewPackage()
+	if err = pkg.OpenFile(wpkname); err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Tagger, err = bulk.MakeTagger(wpkname); err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+// pages reads directory by successive calls with given number of entries,
+// and checks up that entries are sorted.
+func pages(t *testing.T, fsys fs.FS, dir string, n int) (names []string) {
+	var f, err = fsys.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var df, ok = f.(fs.ReadDirFile)
+	if !ok {
+		t.Fatalf("directory '%s' is not fs.ReadDirFile", dir)
+	}
+	for {
+		var list []fs.DirEntry
+		if list, err = df.ReadDir(n); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) == 0 || len(list) > n {
+			t.Fatalf("got %d entries, expected from 1 to %d", len(list), n)
+		}
+		for _, de := range list {
+			names = append(names, de.Name())
+		}
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Fatalf("entries of directory '%s' are not sorted: %v", dir, names)
+		}
+	}
+	return
+}
+
+// Test sorted and paginated reading of package directories,
+// and fs.FS interface implementation by package and union.
+func TestReadDir(t *testing.T) {
+	defer os.Remove(testpack1)
+	defer os.Remove(testpack2)
+	PackFiles(t, testpack1, []string{
+		"img2/marble.jpg",
+		"bounty.jpg",
+		"img1/claustral.jpg",
+		"img1/Qarataşlar.jpg",
+	})
+	PackFiles(t, testpack2, []string{
+		"img2/Uzuncı.jpg",
+		"bounty.jpg",
+	})
+	var pkg1, pkg2 = openpack(t, testpack1), openpack(t, testpack2)
+	defer pkg1.Close()
+	defer pkg2.Close()
+
+	if names := pages(t, pkg1, ".", 1); len(names) != 3 {
+		t.Fatalf("expected 3 entries at package root, got %v", names)
+	}
+	if names := pages(t, pkg1, "img1", 2); len(names) != 2 {
+		t.Fatalf("expected 2 entries at 'img1', got %v", names)
+	}
+	var list, err = pkg1.FTT.ReadDirN(".", 2)
+	if err != nil || len(list) != 2 || list[0].Name() != "bounty.jpg" {
+		t.Fatalf("ReadDirN should return 2 first entries, got %d, %v", len(list), err)
+	}
+	if err = fstest.TestFS(pkg1,
+		"bounty.jpg", "img1/claustral.jpg", "img1/Qarataşlar.jpg", "img2/marble.jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	var u = &wpk.Union{List: []*wpk.Package{pkg2, pkg1}}
+	if names := pages(t, u, "img2", 1); len(names) != 2 {
+		t.Fatalf("expected 2 entries at union 'img2', got %v", names)
+	}
+	if err = fstest.TestFS(u,
+		"bounty.jpg", "img1/claustral.jpg", "img1/Qarataşlar.jpg", "img2/marble.jpg", "img2/Uzuncı.jpg"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The End.
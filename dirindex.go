@@ -0,0 +1,159 @@
+package wpk
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// dirNode is directory at directories index.
+type dirNode struct {
+	files map[string]Void // names of files placed in directory
+	dirs  map[string]int  // names of subdirectories with number of nested files
+}
+
+// dirIndex is directories tree of files tags table. It gives listing
+// of directory and existence check proportional to directory size.
+// Keys are full directory paths, root directory has empty key.
+type dirIndex struct {
+	nodes map[string]*dirNode
+	mux   sync.RWMutex
+}
+
+// splitkey returns directory and base name of file with given key.
+func splitkey(fkey string) (dir, name string) {
+	if i := strings.LastIndexByte(fkey, '/'); i >= 0 {
+		return fkey[:i], fkey[i+1:]
+	}
+	return "", fkey
+}
+
+// dirkey returns index key for given directory path.
+func dirkey(fulldir string) string {
+	if fulldir == "." {
+		return ""
+	}
+	return strings.TrimSuffix(fulldir, "/")
+}
+
+// init resets index.
+func (di *dirIndex) init() {
+	di.mux.Lock()
+	defer di.mux.Unlock()
+	di.nodes = map[string]*dirNode{}
+}
+
+// node returns directory node with given key, it creates node if it absent.
+// Mutex should be locked by caller.
+func (di *dirIndex) node(key string) *dirNode {
+	var n, ok = di.nodes[key]
+	if !ok {
+		n = &dirNode{
+			files: map[string]Void{},
+			dirs:  map[string]int{},
+		}
+		di.nodes[key] = n
+	}
+	return n
+}
+
+// add places file with given key into index.
+func (di *dirIndex) add(fkey string) {
+	di.mux.Lock()
+	defer di.mux.Unlock()
+	if di.nodes == nil {
+		di.nodes = map[string]*dirNode{}
+	}
+
+	var dir, name = splitkey(fkey)
+	var n = di.node(dir)
+	if _, ok := n.files[name]; ok {
+		return
+	}
+	n.files[name] = Void{}
+	for dir != "" {
+		var parent, sub = splitkey(dir)
+		di.node(parent).dirs[sub]++
+		dir = parent
+	}
+}
+
+// del removes file with given key from index.
+// Directories without files are removed too.
+func (di *dirIndex) del(fkey string) {
+	di.mux.Lock()
+	defer di.mux.Unlock()
+
+	var dir, name = splitkey(fkey)
+	var n, ok = di.nodes[dir]
+	if !ok {
+		return
+	}
+	if _, ok = n.files[name]; !ok {
+		return
+	}
+	delete(n.files, name)
+	for {
+		if len(n.files) == 0 && len(n.dirs) == 0 {
+			delete(di.nodes, dir)
+		}
+		if dir == "" {
+			break
+		}
+		var parent, sub = splitkey(dir)
+		n = di.nodes[parent]
+		if n.dirs[sub]--; n.dirs[sub] == 0 {
+			delete(n.dirs, sub)
+		}
+		dir = parent
+	}
+}
+
+// has checks up that directory with given path is present.
+func (di *dirIndex) has(fulldir string) bool {
+	di.mux.RLock()
+	defer di.mux.RUnlock()
+	var _, ok = di.nodes[dirkey(fulldir)]
+	return ok
+}
+
+// list returns sorted names of files and subdirectories
+// of directory with given path.
+func (di *dirIndex) list(fulldir string) (files, dirs []string) {
+	di.mux.RLock()
+	defer di.mux.RUnlock()
+	var n, ok = di.nodes[dirkey(fulldir)]
+	if !ok {
+		return
+	}
+	files = make([]string, 0, len(n.files))
+	for name := range n.files {
+		files = append(files, name)
+	}
+	dirs = make([]string, 0, len(n.dirs))
+	for name := range n.dirs {
+		dirs = append(dirs, name)
+	}
+	sort.Strings(files)
+	sort.Strings(dirs)
+	return
+}
+
+// walk returns sorted keys of all files nested into directory
+// with given path and into its subdirectories.
+func (di *dirIndex) walk(fulldir string) (keys []string) {
+	var prefix = dirkey(fulldir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	var files, dirs = di.list(fulldir)
+	for _, name := range files {
+		keys = append(keys, prefix+name)
+	}
+	for _, name := range dirs {
+		keys = append(keys, di.walk(prefix+name)...)
+	}
+	return
+}
+
+// The End.
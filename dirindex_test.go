@@ -0,0 +1,96 @@
+package wpk_test
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+)
+
+// names returns names of directory entries joined by comma,
+// directories names are followed by slash.
+func names(t *testing.T, fsys fs.ReadDirFS, dir string) string {
+	var list, err = fsys.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s = make([]string, len(list))
+	for i, de := range list {
+		s[i] = de.Name()
+		if de.IsDir() {
+			s[i] += "/"
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+// Test directories index synchronization with files tags table changes.
+func TestDirIndex(t *testing.T) {
+	var pkg = wpk.NewPackage()
+	for _, fkey := range []string{
+		"a.txt",
+		"doc/b.txt",
+		"doc/a.txt",
+		"doc/deep/c.txt",
+		"img/d.jpg",
+	} {
+		pkg.SetTagset(fkey, pkg.BaseTagset(0, 0, fkey))
+	}
+	var check = func(dir, expect string) {
+		if got := names(t, pkg, dir); got != expect {
+			t.Fatalf("directory '%s' has entries '%s', expected '%s'", dir, got, expect)
+		}
+	}
+	check(".", "a.txt,doc/,img/")
+	check("doc", "a.txt,b.txt,deep/")
+	check("doc/deep", "c.txt")
+	check("absent", "")
+	if !pkg.HasDir("doc/deep") || pkg.HasDir("doc/b.txt") || pkg.HasDir("absent") {
+		t.Fatal("existence of directories is not correct")
+	}
+
+	// delete file and whole directory
+	pkg.DelTagset("doc/deep/c.txt")
+	if pkg.HasDir("doc/deep") {
+		t.Fatal("directory without files is present")
+	}
+	check("doc", "a.txt,b.txt")
+	pkg.DelTagset("img/d.jpg")
+	check(".", "a.txt,doc/")
+
+	// rename files and directories
+	if err := pkg.Rename("a.txt", "new/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	check(".", "doc/,new/")
+	if _, err := pkg.RenameDir("doc", "new/doc", false); err != nil {
+		t.Fatal(err)
+	}
+	check(".", "new/")
+	check("new", "a.txt,doc/")
+	check("new/doc", "a.txt,b.txt")
+
+	// sub package uses the same index
+	var sub, err = pkg.Sub("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	sub.(*wpk.Package).Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		keys = append(keys, fkey)
+		return true
+	})
+	if got := strings.Join(keys, ","); got != "a.txt,doc/a.txt,doc/b.txt" {
+		t.Fatalf("sub package has files '%s'", got)
+	}
+	check("new/doc", "a.txt,b.txt")
+	if _, err = pkg.Sub("doc"); err == nil {
+		t.Fatal("sub package is made for absent directory")
+	}
+	if _, err = pkg.Sub("new/a.txt"); err == nil {
+		t.Fatal("sub package is made for file")
+	}
+}
+
+// The End.
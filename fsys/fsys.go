@@ -4,6 +4,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"sync"
 
 	"github.com/schwarzlichtbezirk/wpk"
 )
@@ -13,24 +14,20 @@ type ReaserAtCloser interface {
 	io.Closer
 }
 
-// ChunkFile structure gives access to nested into package file.
+// ChunkFile structure gives access to nested into package file
+// by section of shared package file handle.
 // wpk.RFile interface implementation.
 type ChunkFile struct {
 	wpk.PkgReader
-	wpkf io.Closer
 	tags wpk.TagsetRaw // has fs.FileInfo interface
 }
 
 // NewChunkFile creates ChunkFile file structure based on given tags slice.
-func NewChunkFile(fpath string, ts wpk.TagsetRaw) (f *ChunkFile, err error) {
-	var wpkf wpk.RFile
-	if wpkf, err = os.Open(fpath); err != nil {
-		return
-	}
+// Given reader is shared between files, it is not closed by the file.
+func NewChunkFile(r io.ReaderAt, ts wpk.TagsetRaw) (f *ChunkFile, err error) {
 	var offset, size = ts.Pos()
 	f = &ChunkFile{
-		PkgReader: io.NewSectionReader(wpkf, int64(offset), int64(size)),
-		wpkf:      wpkf,
+		PkgReader: io.NewSectionReader(r, int64(offset), int64(size)),
 		tags:      ts,
 	}
 	return
@@ -41,34 +38,104 @@ func (f *ChunkFile) Stat() (fs.FileInfo, error) {
 	return f.tags, nil
 }
 
-// Close closes associated wpk-file handle.
+// Close does nothing, package file handle is shared and
+// is closed by Tagger. Useful for interface compatibility.
+// io.Closer implementation.
 func (f *ChunkFile) Close() error {
-	return f.wpkf.Close()
+	return nil
 }
 
 // Tagger is object to get access to package nested files
-// by sections of wpk-file reading.
+// by sections of wpk-file reading. All files share the single
+// package file handle, or given io.ReaderAt, that is read by ReadAt calls.
 type Tagger struct {
-	dpath string // package filename
+	r    io.ReaderAt  // package content source, nil after close
+	c    io.Closer    // open package file descriptor, can be nil
+	size int64        // size of source given to MakeTaggerAt
+	unp  wpk.Unpacker // decrypts and unpacks files data
+	mux  sync.RWMutex
 }
 
 // MakeTagger creates Tagger object to get access to package nested files.
 func MakeTagger(fpath string) (wpk.Tagger, error) {
-	var tgr Tagger
-	tgr.dpath = fpath
-	return &tgr, nil
+	var f, err = os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return &Tagger{r: f, c: f}, nil
+}
+
+// MakeTaggerAt creates Tagger object to get access to package nested files
+// placed at any random-access source with given size, such as file embedded
+// by embed.FS, blob in memory, or section of a larger file. Source is not
+// closed by the tagger.
+func MakeTaggerAt(r io.ReaderAt, size int64) (wpk.Tagger, error) {
+	return &Tagger{r: r, size: size}, nil
+}
+
+// MakeCipherTaggerAt creates Tagger object to get access to package nested files
+// placed at random-access source, some of which are encrypted with given key.
+func MakeCipherTaggerAt(r io.ReaderAt, size int64, key []byte) (wpk.Tagger, error) {
+	var tgr = &Tagger{r: r, size: size}
+	if err := tgr.SetKey(key); err != nil {
+		return nil, err
+	}
+	return tgr, nil
+}
+
+// SetKey sets the key to decrypt files encrypted by AES-GCM.
+// wpk.KeySetter implementation.
+func (tgr *Tagger) SetKey(key []byte) error {
+	return tgr.unp.SetKey(key)
 }
 
 // OpenTagset creates file object to give access to nested into package file by given tagset.
+// Compressed file is unpacked at once, encrypted file is decrypted by chunks on demand.
+// Returns fs.ErrClosed if tagger was closed.
 func (tgr *Tagger) OpenTagset(ts wpk.TagsetRaw) (wpk.RFile, error) {
-	return NewChunkFile(tgr.dpath, ts)
+	tgr.mux.RLock()
+	var closed, fixed = tgr.r == nil, tgr.c == nil
+	tgr.mux.RUnlock()
+	if closed {
+		return nil, &fs.PathError{Op: "open", Path: ts.Path(), Err: fs.ErrClosed}
+	}
+	// package file can grow by appended files, size of other sources is fixed
+	if offset, size := ts.Pos(); fixed && int64(offset+size) > tgr.size {
+		return nil, &fs.PathError{Op: "open", Path: ts.Path(), Err: wpk.ErrOutSize}
+	}
+	return tgr.unp.Open(ts, func() (wpk.RFile, error) {
+		return NewChunkFile(tgr, ts)
+	})
 }
 
-// Close file handle. This function must be called only for root object,
-// not subdirectories.
+// ReadAt reads package content from the source. Returns fs.ErrClosed
+// if tagger was closed, so files opened before can not be read after it.
+// io.ReaderAt implementation.
+func (tgr *Tagger) ReadAt(p []byte, off int64) (int, error) {
+	tgr.mux.RLock()
+	defer tgr.mux.RUnlock()
+	if tgr.r == nil {
+		return 0, fs.ErrClosed
+	}
+	return tgr.r.ReadAt(p, off)
+}
+
+// Close releases shared package file handle, files opened before
+// can not be read after it, except files of solid blocks that are
+// unpacked into memory at once. Source given to MakeTaggerAt is not
+// closed, but tagger refuses new files and reading of opened files
+// in the same way. This function must be called only for root object,
+// not subdirectories. Next calls have no effect.
 // io.Closer implementation.
-func (tgr *Tagger) Close() error {
-	return nil
+func (tgr *Tagger) Close() (err error) {
+	tgr.mux.Lock()
+	defer tgr.mux.Unlock()
+	if tgr.c != nil {
+		err = tgr.c.Close()
+		tgr.c = nil
+	}
+	tgr.r = nil
+	return
 }
 
 // The End.
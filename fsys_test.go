@@ -0,0 +1,73 @@
+package wpk_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk/fsys"
+)
+
+// Test concurrent reading of files by fsys tagger with shared file handle.
+func TestFsysShared(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+	const num = 64
+
+	var files = map[string]string{}
+	for i := 0; i < num; i++ {
+		files[fmt.Sprintf("file%d.txt", i)] = fmt.Sprintf("content of file #%d", i)
+	}
+	var pkg = packmap(t, testpack1, files)
+	pkg.Close()
+	if pkg.Tagger, err = fsys.MakeTagger(testpack1); err != nil {
+		t.Fatal(err)
+	}
+
+	// open all files at once, and read them concurrently
+	var list = make([]fs.File, 0, num)
+	for i := 0; i < num; i++ {
+		var f fs.File
+		if f, err = pkg.Open(fmt.Sprintf("file%d.txt", i)); err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, f)
+	}
+	var wg sync.WaitGroup
+	var errs = make([]error, num)
+	for i, f := range list {
+		wg.Add(1)
+		go func(i int, f fs.File) {
+			defer wg.Done()
+			defer f.Close()
+			var b, err = io.ReadAll(f)
+			if err == nil && string(b) != files[fmt.Sprintf("file%d.txt", i)] {
+				err = fmt.Errorf("wrong content of file #%d", i)
+			}
+			errs[i] = err
+		}(i, f)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// closed tagger refuses new files
+	if err = pkg.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pkg.Open("file0.txt"); !errors.Is(err, fs.ErrClosed) {
+		t.Fatalf("expected error on closed tagger, got %v", err)
+	}
+	if err = pkg.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The End.
@@ -5,8 +5,9 @@ go 1.20
 require (
 	github.com/edsrzf/mmap-go v1.2.0
 	github.com/h2non/filetype v1.1.3
+	github.com/hanwen/go-fuse/v2 v2.9.0
 	github.com/yuin/gopher-lua v1.1.1
 	gopkg.in/djherbis/times.v1 v1.3.0
 )
 
-require golang.org/x/sys v0.22.0 // indirect
+require golang.org/x/sys v0.28.0 // indirect
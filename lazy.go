@@ -0,0 +1,277 @@
+package wpk
+
+import (
+	"errors"
+	"hash/fnv"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/schwarzlichtbezirk/wpk/util"
+)
+
+// IndexSign is signature at the start of index section,
+// that follows files tags table.
+const IndexSign = "WPKI"
+
+// Size of index section record: path hash and tagset offset.
+const indexrec = 16
+
+// Errors on lazy files tags table.
+var (
+	ErrNoIndex  = errors.New("package has no index section")
+	ErrBadIndex = errors.New("index section does not match files tags table")
+)
+
+// lazyTable is files tags table placed at memory, tagsets
+// are found on demand by index section without parsing whole table.
+type lazyTable struct {
+	ftt   []byte // files tags table content
+	index []byte // sorted index records
+	count int    // number of files tagsets
+	first int    // offset of first files tagset in the table
+
+	once sync.Once  // builds directories index on first demand
+	mux  sync.Mutex // serializes loading of the table
+}
+
+// pathhash returns hash of file key used at index section.
+func pathhash(fkey string) uint64 {
+	var h = fnv.New64a()
+	h.Write(util.S2B(fkey))
+	return h.Sum64()
+}
+
+// SetIndex turns on or off writing of index section on sync. Index section
+// is sorted list of path hashes with tagsets offsets, placed after files tags
+// table. It allows to open package by OpenLazy without table parsing.
+func (ftt *FTT) SetIndex(on bool) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	ftt.index = on
+}
+
+// writeindex writes index section for files tags table written by writeto.
+// Mutex should be locked by caller.
+func (ftt *FTT) writeindex(w io.Writer) (err error) {
+	var recs = make([]byte, 0, ftt.tsm.Len()*indexrec)
+	var pos = uint64(PTStssize + len(ftt.info))
+	ftt.tsm.Range(func(fkey string, ts TagsetRaw) bool {
+		var rec [indexrec]byte
+		util.SetU64(rec[:8], pathhash(fkey))
+		util.SetU64(rec[8:], pos)
+		recs = append(recs, rec[:]...)
+		pos += uint64(PTStssize + len(ts))
+		return true
+	})
+	sort.Sort(indexsort(recs))
+
+	if _, err = w.Write(util.S2B(IndexSign)); err != nil {
+		return
+	}
+	if err = util.WriteU64(w, uint64(len(recs)/indexrec)); err != nil {
+		return
+	}
+	_, err = w.Write(recs)
+	return
+}
+
+// indexsort sorts index records by hash, and then by offset.
+type indexsort []byte
+
+func (s indexsort) Len() int {
+	return len(s) / indexrec
+}
+
+func (s indexsort) Less(i, j int) bool {
+	var a, b = s[i*indexrec:], s[j*indexrec:]
+	if ha, hb := util.GetU64(a), util.GetU64(b); ha != hb {
+		return ha < hb
+	}
+	return util.GetU64(a[8:]) < util.GetU64(b[8:])
+}
+
+func (s indexsort) Swap(i, j int) {
+	var a, b [indexrec]byte
+	copy(a[:], s[i*indexrec:])
+	copy(b[:], s[j*indexrec:])
+	copy(s[i*indexrec:], b[:])
+	copy(s[j*indexrec:], a[:])
+}
+
+// OpenLazy opens package placed at given slice in lazy mode. Slice should
+// contain whole package file, or tags file of splitted package, it can be
+// memory mapped file. Files tags table is not parsed, tagsets are found by
+// binary search at index section written by Sync, and directories index is
+// built on first directory access. Slice must remain valid while package
+// is used. Table is loaded wholly on first modification of the package.
+// If trusted keys were set, digital signature of the table is verified.
+func (ftt *FTT) OpenLazy(b []byte) (err error) {
+	var hdr Header
+	if _, err = hdr.Parse(b); err != nil {
+		return
+	}
+	if err = hdr.IsReady(); err != nil {
+		return
+	}
+	// setup empty tags table without reserved map size
+	ftt.Init(&Header{datoffset: hdr.datoffset, datsize: hdr.datsize})
+	if hdr.fttcount == 0 || hdr.fttsize == 0 {
+		return
+	}
+	var fttend = hdr.fttoffset + hdr.fttsize
+	if fttend > uint64(len(b)) || hdr.fttsize < 2*PTStssize {
+		return io.ErrUnexpectedEOF
+	}
+	var lt = &lazyTable{
+		ftt:   b[hdr.fttoffset:fttend],
+		count: int(hdr.fttcount),
+	}
+
+	// read tagset with package info
+	var tsl = int(util.GetU16(lt.ftt))
+	lt.first = PTStssize + tsl
+	if lt.first+PTStssize > len(lt.ftt) {
+		return io.ErrUnexpectedEOF
+	}
+	var info = TagsetRaw(lt.ftt[PTStssize:lt.first])
+	var tsi = info.Iterator()
+	for tsi.Next() {
+	}
+	if tsi.Failed() {
+		return io.ErrUnexpectedEOF
+	}
+
+	// check up index section
+	var idx = b[fttend:]
+	if len(idx) < len(IndexSign)+8 || util.B2S(idx[:len(IndexSign)]) != IndexSign {
+		return ErrNoIndex
+	}
+	if util.GetU64(idx[len(IndexSign):]) != hdr.fttcount ||
+		uint64(len(idx)-len(IndexSign)-8) < hdr.fttcount*indexrec {
+		return ErrBadIndex
+	}
+	lt.index = idx[len(IndexSign)+8:][:hdr.fttcount*indexrec]
+
+	ftt.info = info
+	ftt.lazy.Store(lt)
+	// check up digital signature if trusted keys are set
+	if ftt.trusted != nil {
+		err = ftt.VerifySign(ftt.trusted...)
+	}
+	return
+}
+
+// IsLazy returns true if files tags table was opened in lazy mode
+// and was not loaded yet.
+func (ftt *FTT) IsLazy() bool {
+	return ftt.lazy.Load() != nil
+}
+
+// Load parses wholly the files tags table opened in lazy mode.
+// It does nothing for table that was opened or loaded before.
+// Table content is copied, so slice given to OpenLazy is not used
+// after loading. Readers use lazy table until loading is complete.
+func (ftt *FTT) Load() (err error) {
+	var lt = ftt.lazy.Load()
+	if lt == nil {
+		return
+	}
+	lt.mux.Lock()
+	defer lt.mux.Unlock()
+	if ftt.lazy.Load() != lt {
+		return // loaded by concurrent call
+	}
+	var n int64
+	var buf = append([]byte(nil), lt.ftt...)
+	ftt.tsm.Init(lt.count)
+	if n, err = ftt.Parse(buf); err == nil && n != int64(len(buf)) {
+		err = ErrSignFTT
+	}
+	if err != nil {
+		ftt.tsm.Init(0)
+		return
+	}
+	ftt.lazy.Store(nil)
+	return
+}
+
+// tagset returns files tagset placed at given offset of the table.
+func (lt *lazyTable) tagset(pos uint64) (ts TagsetRaw, ok bool) {
+	if pos+PTStssize > uint64(len(lt.ftt)) {
+		return
+	}
+	var tsl = uint64(util.GetU16(lt.ftt[pos:]))
+	pos += PTStssize
+	if tsl == 0 || pos+tsl > uint64(len(lt.ftt)) {
+		return
+	}
+	return TagsetRaw(lt.ftt[pos : pos+tsl]), true
+}
+
+// get returns tagset with given file key found by index section.
+func (lt *lazyTable) get(ftt *FTT, fkey string) (ts TagsetRaw, ok bool) {
+	var h = pathhash(fkey)
+	var i = sort.Search(lt.count, func(i int) bool {
+		return util.GetU64(lt.index[i*indexrec:]) >= h
+	})
+	for ; i < lt.count && util.GetU64(lt.index[i*indexrec:]) == h; i++ {
+		if ts, ok = lt.tagset(util.GetU64(lt.index[i*indexrec+8:])); !ok {
+			continue
+		}
+		var offset, size = ts.Pos()
+		if util.ToSlash(ts.Path()) == fkey &&
+			uint64(offset) >= ftt.datoffset && uint64(offset+size) <= ftt.datoffset+ftt.datsize {
+			return
+		}
+	}
+	return nil, false
+}
+
+// each calls given closure for each tagset in order of the table.
+func (lt *lazyTable) each(f func(string, TagsetRaw) bool) {
+	var pos = uint64(lt.first)
+	for {
+		var ts, ok = lt.tagset(pos)
+		if !ok {
+			return
+		}
+		pos += PTStssize + uint64(len(ts))
+		if !f(util.ToSlash(ts.Path()), ts) {
+			return
+		}
+	}
+}
+
+// peek returns tagset with given full file key from loaded or lazy table.
+func (ftt *FTT) peek(fkey string) (TagsetRaw, bool) {
+	if lt := ftt.lazy.Load(); lt != nil {
+		return lt.get(ftt, fkey)
+	}
+	return ftt.tsm.Peek(fkey)
+}
+
+// rangeall calls given closure for each tagset of loaded or lazy table.
+func (ftt *FTT) rangeall(f func(string, TagsetRaw) bool) {
+	if lt := ftt.lazy.Load(); lt != nil {
+		lt.each(f)
+		return
+	}
+	ftt.tsm.Range(f)
+}
+
+// dirindex returns directories index, it builds index
+// for lazy table on first call.
+func (ftt *FTT) dirindex() *dirIndex {
+	if lt := ftt.lazy.Load(); lt != nil {
+		lt.once.Do(func() {
+			lt.each(func(fkey string, ts TagsetRaw) bool {
+				ftt.dirs.add(fkey)
+				return true
+			})
+		})
+	}
+	return &ftt.dirs
+}
+
+// The End.
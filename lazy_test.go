@@ -0,0 +1,190 @@
+package wpk_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+)
+
+// packindexed writes package with index section and given number of files
+// placed into few directories, and returns package file content.
+func packindexed(t *testing.T, wpkname string, num int, seed []byte) []byte {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	if fwpk, err = os.OpenFile(wpkname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetIndex(true)
+	if err = pkg.SetSigner(seed); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < num; i++ {
+		var fkey = fmt.Sprintf("dir%d/file%d.txt", i%4, i)
+		var content = fmt.Sprintf("content of file #%d", i)
+		if _, err = pkg.PackData(fwpk, bytes.NewReader([]byte(content)), fkey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var b []byte
+	if b, err = os.ReadFile(wpkname); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Test package opened in lazy mode by index section.
+func TestOpenLazy(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+	const num = 1000
+
+	var seed = make([]byte, ed25519.SeedSize)
+	var pub = ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	var b = packindexed(t, testpack1, num, seed)
+
+	var pkg = wpk.NewPackage()
+	pkg.SetTrusted(pub)
+	if err = pkg.OpenLazy(b); err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Tagger, err = bulk.MakeTagger(testpack1); err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.Close()
+	if !pkg.IsLazy() {
+		t.Fatal("package is not in lazy mode")
+	}
+	if pkg.TagsetNum() != num {
+		t.Fatalf("expected %d tagsets, got %d", num, pkg.TagsetNum())
+	}
+
+	// find files by index
+	for _, i := range []int{0, 1, 500, num - 1} {
+		var fkey = fmt.Sprintf("dir%d/file%d.txt", i%4, i)
+		var data []byte
+		if data, err = pkg.ReadFile(fkey); err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != fmt.Sprintf("content of file #%d", i) {
+			t.Fatalf("wrong content of file '%s'", fkey)
+		}
+		if _, err = pkg.Stat(fkey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pkg.HasTagset("dir0/file1.txt") || pkg.HasTagset("absent.txt") {
+		t.Fatal("absent file is found")
+	}
+
+	// enumerate and list directories
+	var count int
+	pkg.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		count++
+		return true
+	})
+	if count != num {
+		t.Fatalf("enumerated %d tagsets, expected %d", count, num)
+	}
+	var list, _ = pkg.ReadDir("dir1")
+	if len(list) != num/4 {
+		t.Fatalf("directory has %d entries, expected %d", len(list), num/4)
+	}
+	if err = fstest.TestFS(pkg, "dir0/file0.txt", "dir3/file999.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if !pkg.IsLazy() {
+		t.Fatal("package is loaded on reading")
+	}
+
+	// table is loaded on modification
+	pkg.DelTagset("dir0/file0.txt")
+	if pkg.IsLazy() {
+		t.Fatal("package is not loaded on modification")
+	}
+	if pkg.TagsetNum() != num-1 || pkg.HasTagset("dir0/file0.txt") || !pkg.HasTagset("dir1/file1.txt") {
+		t.Fatal("loaded package has wrong content")
+	}
+
+	// loaded table does not refer to source slice
+	var src = append([]byte(nil), b...)
+	for i := range b {
+		b[i] = 0
+	}
+	if ts, ok := pkg.GetTagset("dir1/file1.txt"); !ok || ts.Path() != "dir1/file1.txt" {
+		t.Fatal("loaded table refers to source slice")
+	}
+	copy(b, src)
+
+	// table is loaded while it's read concurrently
+	pkg = wpk.NewPackage()
+	if err = pkg.OpenLazy(b); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for j := 0; j < 4; j++ {
+		wg.Add(1)
+		go func(j int) {
+			defer wg.Done()
+			for i := j; i < num; i += 4 {
+				if !pkg.HasTagset(fmt.Sprintf("dir%d/file%d.txt", i%4, i)) {
+					t.Errorf("file #%d is not found", i)
+					return
+				}
+			}
+		}(j)
+	}
+	pkg.SetTagset("new.txt", wpk.TagsetRaw{}.Put(wpk.TIDpath, wpk.StrTag("new.txt")))
+	wg.Wait()
+	if pkg.IsLazy() || pkg.TagsetNum() != num+1 {
+		t.Fatal("package is not loaded on concurrent modification")
+	}
+
+	// table that can not be loaded is not modified
+	var dup = bytes.Replace(src, []byte("dir2/file2.txt"), []byte("dir1/file1.txt"), 1)
+	pkg = wpk.NewPackage()
+	if err = pkg.OpenLazy(dup); err != nil {
+		t.Fatal(err)
+	}
+	if err = pkg.SetTagset("new.txt", wpk.TagsetRaw{}.Put(wpk.TIDpath, wpk.StrTag("new.txt"))); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected error on loading of table with repeated file, got %v", err)
+	}
+	if _, ok := pkg.DelTagset("dir3/file3.txt"); ok {
+		t.Fatal("file is deleted from table that can not be loaded")
+	}
+	if !pkg.IsLazy() || pkg.HasTagset("new.txt") || !pkg.HasTagset("dir3/file3.txt") {
+		t.Fatal("table that can not be loaded is modified")
+	}
+
+	// index section is absent
+	var plain = packmap(t, testpack2, map[string]string{"file.txt": "content"})
+	plain.Close()
+	defer os.Remove(testpack2)
+	if b, err = os.ReadFile(testpack2); err != nil {
+		t.Fatal(err)
+	}
+	if err = wpk.NewPackage().OpenLazy(b); !errors.Is(err, wpk.ErrNoIndex) {
+		t.Fatalf("expected error on package without index, got %v", err)
+	}
+}
+
+// The End.
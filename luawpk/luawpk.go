@@ -1,12 +1,16 @@
 package luawpk
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"mime"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	lua "github.com/yuin/gopher-lua"
 
@@ -18,26 +22,42 @@ var (
 	ErrPackOpened = errors.New("package write stream already opened")
 	ErrPackClosed = errors.New("package write stream does not opened")
 	ErrDataClosed = errors.New("package data file is not opened")
+	ErrCompMode   = errors.New("compression mode is not supported")
 )
 
+// CompMode helps to convert compression mode names to compression selectors.
+var CompMode = map[string]wpk.CompSelector{
+	"none":    nil,
+	"deflate": wpk.CompAll(wpk.CompDeflate),
+	"auto":    wpk.CompByMIME(wpk.CompDeflate),
+}
+
 // PackMT is "wpk" name of Lua metatable.
 const PackMT = "wpk"
 
 // LuaPackage is "wpk" userdata structure.
 type LuaPackage struct {
 	wpk.Package
-	fidcount uint
-	autofid  bool
-	automime bool
-	secret   []byte
-	crc32    bool
-	crc64    bool
-	md5      bool
-	sha1     bool
-	sha224   bool
-	sha256   bool
-	sha384   bool
-	sha512   bool
+	fidcount  uint
+	autofid   bool
+	automime  bool
+	compress  string
+	solid     int
+	cipherkey string
+	signed    bool
+	dedup     bool
+	variant   bool
+	repro     bool
+	epoch     int64
+	secret    []byte
+	crc32     bool
+	crc64     bool
+	md5       bool
+	sha1      bool
+	sha224    bool
+	sha256    bool
+	sha384    bool
+	sha512    bool
 
 	pkgpath string
 	datpath string
@@ -82,6 +102,54 @@ func NewPack(ls *lua.LState) int {
 	return 1
 }
 
+// applyrepro applies reproducible build settings to package.
+// Epoch is taken from SOURCE_DATE_EPOCH if it was not set by script.
+func (pkg *LuaPackage) applyrepro() {
+	var epoch time.Time
+	if pkg.epoch > 0 {
+		epoch = time.Unix(pkg.epoch, 0)
+	} else {
+		epoch, _ = wpk.SourceDateEpoch()
+	}
+	pkg.SetReproducible(pkg.repro, epoch)
+}
+
+// putvariant packs gzip variant of file with given key in variant mode,
+// if file has compressible MIME type and variant is not present yet.
+func (pkg *LuaPackage) putvariant(w io.WriteSeeker, r io.ReadSeeker, fkey string, ts wpk.TagsetRaw) (err error) {
+	if !pkg.variant || pkg.HasTagset(wpk.VariantKey(fkey, "gzip")) {
+		return
+	}
+	var ctype, ok = ts.TagStr(wpk.TIDmime)
+	if !ok {
+		ctype = mime.TypeByExtension(path.Ext(fkey))
+	}
+	if !wpk.IsCompressible(ctype) {
+		return
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	var data, buf []byte
+	if data, err = io.ReadAll(r); err != nil {
+		return
+	}
+	if buf, err = wpk.EncodeGzip(data); err != nil || len(buf) >= len(data) {
+		return
+	}
+	var vr = bytes.NewReader(buf)
+	var vts wpk.TagsetRaw
+	if vts, err = pkg.PackVariant(w, vr, fkey, "gzip"); err != nil {
+		return
+	}
+	if vts, err = pkg.adjusttagset(vr, vts); err != nil {
+		return
+	}
+	pkg.SetupTagset(vts)
+	return
+}
+
 // CheckPack checks whether the lua argument with given number is
 // a *LUserData with *LuaPackage and returns this *LuaPackage.
 func CheckPack(ls *lua.LState, arg int) *LuaPackage {
@@ -184,6 +252,16 @@ var propertiesPack = []struct {
 	{"datasize", getdatasize, nil},
 	{"autofid", getautofid, setautofid},
 	{"automime", getautomime, setautomime},
+	{"compress", getcompress, setcompress},
+	{"solid", getsolid, setsolid},
+	{"cipherkey", getcipherkey, setcipherkey},
+	{"signkey", getsignkey, setsignkey},
+	{"dedup", getdedup, setdedup},
+	{"dedupnum", getdedupnum, nil},
+	{"dedupsize", getdedupsize, nil},
+	{"variant", getvariant, setvariant},
+	{"repro", getrepro, setrepro},
+	{"epoch", getepoch, setepoch},
 	{"secret", getsecret, setsecret},
 	{"crc32", getcrc32, setcrc32},
 	{"crc64", getcrc64, setcrc64},
@@ -196,32 +274,33 @@ var propertiesPack = []struct {
 }
 
 var methodsPack = map[string]lua.LGFunction{
-	"load":      wpkload,
-	"begin":     wpkbegin,
-	"append":    wpkappend,
-	"finalize":  wpkfinalize,
-	"flush":     wpkflush,
-	"sumsize":   wpksumsize,
-	"glob":      wpkglob,
-	"hasfile":   wpkhasfile,
-	"filesize":  wpkfilesize,
-	"putdata":   wpkputdata,
-	"putfile":   wpkputfile,
-	"rename":    wpkrename,
-	"renamedir": wpkrenamedir,
-	"putalias":  wpkputalias,
-	"delalias":  wpkdelalias,
-	"hastag":    wpkhastag,
-	"gettag":    wpkgettag,
-	"settag":    wpksettag,
-	"addtag":    wpkaddtag,
-	"deltag":    wpkdeltag,
-	"gettags":   wpkgettags,
-	"settags":   wpksettags,
-	"addtags":   wpkaddtags,
-	"deltags":   wpkdeltags,
-	"getinfo":   wpkgetinfo,
-	"setupinfo": wpksetupinfo,
+	"load":        wpkload,
+	"begin":       wpkbegin,
+	"append":      wpkappend,
+	"finalize":    wpkfinalize,
+	"flush":       wpkflush,
+	"sumsize":     wpksumsize,
+	"glob":        wpkglob,
+	"hasfile":     wpkhasfile,
+	"filesize":    wpkfilesize,
+	"putdata":     wpkputdata,
+	"putfile":     wpkputfile,
+	"rename":      wpkrename,
+	"renamedir":   wpkrenamedir,
+	"putalias":    wpkputalias,
+	"linkvariant": wpklinkvariant,
+	"delalias":    wpkdelalias,
+	"hastag":      wpkhastag,
+	"gettag":      wpkgettag,
+	"settag":      wpksettag,
+	"addtag":      wpkaddtag,
+	"deltag":      wpkdeltag,
+	"gettags":     wpkgettags,
+	"settags":     wpksettags,
+	"addtags":     wpkaddtags,
+	"deltags":     wpkdeltags,
+	"getinfo":     wpkgetinfo,
+	"setupinfo":   wpksetupinfo,
 }
 
 // properties section
@@ -330,6 +409,162 @@ func setautomime(ls *lua.LState) int {
 	return 0
 }
 
+func getcompress(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	if pkg.compress == "" {
+		ls.Push(lua.LString("none"))
+		return 1
+	}
+	ls.Push(lua.LString(pkg.compress))
+	return 1
+}
+
+func setcompress(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var val = ls.CheckString(2)
+
+	var sel, ok = CompMode[val]
+	if !ok {
+		ls.RaiseError(ErrCompMode.Error())
+		return 0
+	}
+	pkg.compress = val
+	pkg.SetCompress(sel)
+	return 0
+}
+
+func getsolid(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	ls.Push(lua.LNumber(pkg.solid))
+	return 1
+}
+
+func setsolid(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var val = ls.CheckInt(2)
+
+	pkg.solid = val
+	pkg.SetSolid(val, val/4)
+	return 0
+}
+
+func getcipherkey(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	ls.Push(lua.LString(pkg.cipherkey))
+	return 1
+}
+
+func setcipherkey(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var val = ls.CheckString(2)
+
+	var key []byte
+	if val != "" {
+		key = []byte(val)
+	}
+	if err := pkg.SetCipher(key); err != nil {
+		ls.RaiseError(err.Error())
+		return 0
+	}
+	pkg.cipherkey = val
+	return 0
+}
+
+func getdedup(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	ls.Push(lua.LBool(pkg.dedup))
+	return 1
+}
+
+func setdedup(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var val = ls.CheckBool(2)
+
+	pkg.dedup = val
+	pkg.SetDedup(val)
+	return 0
+}
+
+func getdedupnum(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var num, _ = pkg.DedupStat()
+	ls.Push(lua.LNumber(num))
+	return 1
+}
+
+func getdedupsize(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var _, saved = pkg.DedupStat()
+	ls.Push(lua.LNumber(saved))
+	return 1
+}
+
+func getvariant(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	ls.Push(lua.LBool(pkg.variant))
+	return 1
+}
+
+func setvariant(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var val = ls.CheckBool(2)
+
+	pkg.variant = val
+	return 0
+}
+
+func getrepro(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	ls.Push(lua.LBool(pkg.repro))
+	return 1
+}
+
+func setrepro(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var val = ls.CheckBool(2)
+
+	pkg.repro = val
+	pkg.applyrepro()
+	return 0
+}
+
+func getepoch(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	ls.Push(lua.LNumber(pkg.epoch))
+	return 1
+}
+
+func setepoch(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var val = ls.CheckInt64(2)
+
+	if val < 0 {
+		ls.ArgError(2, "epoch can not be negative")
+		return 0
+	}
+	pkg.epoch = val
+	pkg.applyrepro()
+	return 0
+}
+
+func getsignkey(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	ls.Push(lua.LBool(pkg.signed))
+	return 1
+}
+
+func setsignkey(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var val = ls.CheckString(2)
+
+	if err := pkg.SetSigner([]byte(val)); err != nil {
+		ls.RaiseError(err.Error())
+		return 0
+	}
+	pkg.signed = val != ""
+	return 0
+}
+
 func getsecret(ls *lua.LState) int {
 	var pkg = CheckPack(ls, 1)
 	ls.Push(lua.LString(pkg.secret))
@@ -673,7 +908,7 @@ func wpkfilesize(ls *lua.LState) int {
 
 	var ts wpk.TagsetRaw
 	var ok bool
-	if ts, ok = pkg.GetTagset(fkey); !ok {
+	if ts, ok = pkg.PeekTagset(fkey); !ok {
 		err = &fs.PathError{Op: "filesize", Path: fkey, Err: fs.ErrNotExist}
 		return 0
 	}
@@ -721,6 +956,10 @@ func wpkputdata(ls *lua.LState) int {
 
 	pkg.SetupTagset(ts)
 
+	if err = pkg.putvariant(w, r, fkey, ts); err != nil {
+		return 0
+	}
+
 	return 0
 }
 
@@ -766,6 +1005,10 @@ func wpkputfile(ls *lua.LState) int {
 
 	pkg.SetupTagset(ts)
 
+	if err = pkg.putvariant(w, file, fkey, ts); err != nil {
+		return 0
+	}
+
 	return 0
 }
 
@@ -839,6 +1082,25 @@ func wpkputalias(ls *lua.LState) int {
 	return 0
 }
 
+// Marks already packed file with content-coding suffix as pre-compressed
+// variant of given file.
+// linkvariant(fkey, enc)
+//
+//	fkey - file name of primary file
+//	enc - content-coding of variant, "gzip", "br" or "zstd"
+func wpklinkvariant(ls *lua.LState) int {
+	var pkg = CheckPack(ls, 1)
+	var fkey = ls.CheckString(2)
+	var enc = ls.CheckString(3)
+
+	if wpk.VariantKey(fkey, enc) == "" {
+		ls.ArgError(3, wpk.ErrVariantEnc.Error())
+		return 0
+	}
+	ls.Push(lua.LBool(pkg.LinkVariant(fkey, enc)))
+	return 1
+}
+
 // Deletes tagset with given file name. Data block will still persist.
 func wpkdelalias(ls *lua.LState) int {
 	var pkg = CheckPack(ls, 1)
@@ -869,7 +1131,7 @@ func wpkhastag(ls *lua.LState) int {
 
 	var ts wpk.TagsetRaw
 	var ok bool
-	if ts, ok = pkg.GetTagset(fkey); !ok {
+	if ts, ok = pkg.PeekTagset(fkey); !ok {
 		err = &fs.PathError{Op: "hastag", Path: fkey, Err: fs.ErrNotExist}
 		return 0
 	}
@@ -898,7 +1160,7 @@ func wpkgettag(ls *lua.LState) int {
 
 	var ts wpk.TagsetRaw
 	var ok bool
-	if ts, ok = pkg.GetTagset(fkey); !ok {
+	if ts, ok = pkg.PeekTagset(fkey); !ok {
 		err = &fs.PathError{Op: "gettag", Path: fkey, Err: fs.ErrNotExist}
 		return 0
 	}
@@ -933,7 +1195,7 @@ func wpksettag(ls *lua.LState) int {
 	if tid, err = ValueToTID(k); err != nil {
 		return 0
 	}
-	if tid == wpk.TIDoffset || tid == wpk.TIDsize || tid == wpk.TIDpath {
+	if IsProtected(tid) {
 		err = &ErrProtected{tid}
 		return 0
 	}
@@ -943,7 +1205,7 @@ func wpksettag(ls *lua.LState) int {
 		return 0
 	}
 
-	var ts, ok = pkg.GetTagset(fkey)
+	var ts, ok = pkg.PeekTagset(fkey)
 	if !ok {
 		err = &fs.PathError{Op: "settag", Path: fkey, Err: fs.ErrNotExist}
 		return 0
@@ -973,7 +1235,7 @@ func wpkaddtag(ls *lua.LState) int {
 	if tid, err = ValueToTID(k); err != nil {
 		return 0
 	}
-	if tid == wpk.TIDoffset || tid == wpk.TIDsize || tid == wpk.TIDpath {
+	if IsProtected(tid) {
 		err = &ErrProtected{tid}
 		return 0
 	}
@@ -983,7 +1245,7 @@ func wpkaddtag(ls *lua.LState) int {
 		return 0
 	}
 
-	var ts, ok = pkg.GetTagset(fkey)
+	var ts, ok = pkg.PeekTagset(fkey)
 	if !ok {
 		err = &fs.PathError{Op: "addtag", Path: fkey, Err: fs.ErrNotExist}
 		return 0
@@ -1013,12 +1275,12 @@ func wpkdeltag(ls *lua.LState) int {
 	if tid, err = ValueToTID(k); err != nil {
 		return 0
 	}
-	if tid == wpk.TIDoffset || tid == wpk.TIDsize || tid == wpk.TIDpath {
+	if IsProtected(tid) {
 		err = &ErrProtected{tid}
 		return 0
 	}
 
-	var ts, ok = pkg.GetTagset(fkey)
+	var ts, ok = pkg.PeekTagset(fkey)
 	if !ok {
 		err = &fs.PathError{Op: "deltag", Path: fkey, Err: fs.ErrNotExist}
 		return 0
@@ -1042,7 +1304,7 @@ func wpkgettags(ls *lua.LState) int {
 	var pkg = CheckPack(ls, 1)
 	var fkey = ls.CheckString(2)
 
-	var ts, ok = pkg.GetTagset(fkey)
+	var ts, ok = pkg.PeekTagset(fkey)
 	if !ok {
 		err = &fs.PathError{Op: "gettags", Path: fkey, Err: fs.ErrNotExist}
 		return 0
@@ -1083,7 +1345,7 @@ func wpksettags(ls *lua.LState) int {
 		return 0
 	}
 
-	var ts, ok = pkg.GetTagset(fkey)
+	var ts, ok = pkg.PeekTagset(fkey)
 	if !ok {
 		err = &fs.PathError{Op: "settags", Path: fkey, Err: fs.ErrNotExist}
 		return 0
@@ -1117,7 +1379,7 @@ func wpkaddtags(ls *lua.LState) int {
 		return 0
 	}
 
-	var ts, ok = pkg.GetTagset(fkey)
+	var ts, ok = pkg.PeekTagset(fkey)
 	if !ok {
 		err = &fs.PathError{Op: "addtags", Path: fkey, Err: fs.ErrNotExist}
 		return 0
@@ -1157,7 +1419,7 @@ func wpkdeltags(ls *lua.LState) int {
 		return 0
 	}
 
-	var ts, ok = pkg.GetTagset(fkey)
+	var ts, ok = pkg.PeekTagset(fkey)
 	if !ok {
 		err = &fs.PathError{Op: "deltags", Path: fkey, Err: fs.ErrNotExist}
 		return 0
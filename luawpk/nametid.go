@@ -49,6 +49,23 @@ var TidType = map[wpk.TID]int{
 	wpk.TIDsha384: TTbin,
 	wpk.TIDsha512: TTbin,
 
+	wpk.TIDcomp:   TTuint,
+	wpk.TIDfsize:  TTuint,
+	wpk.TIDblock:  TTuint,
+	wpk.TIDblkoff: TTuint,
+	wpk.TIDcipher: TTuint,
+	wpk.TIDnonce:  TTbin,
+	wpk.TIDsign:   TTbin,
+	wpk.TIDkeyid:  TTbin,
+
+	wpk.TIDvariant:  TTstr,
+	wpk.TIDencoding: TTstr,
+	wpk.TIDwhiteout: TTbool,
+	wpk.TIDdellist:  TTstr,
+	wpk.TIDdelta:    TTstr,
+	wpk.TIDdeltasum: TTbin,
+	wpk.TIDdeltalen: TTuint,
+
 	wpk.TIDtmbjpeg:  TTbin,
 	wpk.TIDtmbwebp:  TTbin,
 	wpk.TIDlabel:    TTstr,
@@ -87,6 +104,23 @@ var NameTid = map[string]wpk.TID{
 	"sha384": wpk.TIDsha384,
 	"sha512": wpk.TIDsha512,
 
+	"comp":   wpk.TIDcomp,
+	"fsize":  wpk.TIDfsize,
+	"block":  wpk.TIDblock,
+	"blkoff": wpk.TIDblkoff,
+	"cipher": wpk.TIDcipher,
+	"nonce":  wpk.TIDnonce,
+	"sign":   wpk.TIDsign,
+	"keyid":  wpk.TIDkeyid,
+
+	"variant":  wpk.TIDvariant,
+	"encoding": wpk.TIDencoding,
+	"whiteout": wpk.TIDwhiteout,
+	"dellist":  wpk.TIDdellist,
+	"delta":    wpk.TIDdelta,
+	"deltasum": wpk.TIDdeltasum,
+	"deltalen": wpk.TIDdeltalen,
+
 	"tmbjpeg":  wpk.TIDtmbjpeg,
 	"tmbwebp":  wpk.TIDtmbwebp,
 	"label":    wpk.TIDlabel,
@@ -125,6 +159,20 @@ func (e *ErrProtected) Error() string {
 	return fmt.Sprintf("tries to change protected tag '%s'", TidName[e.tid])
 }
 
+// IsProtected returns true for tags that describes file data placement,
+// or how file content is reconstructed or hidden at union, such tags
+// can not be changed by script.
+func IsProtected(tid wpk.TID) bool {
+	switch tid {
+	case wpk.TIDoffset, wpk.TIDsize, wpk.TIDpath,
+		wpk.TIDcomp, wpk.TIDfsize, wpk.TIDblock, wpk.TIDblkoff,
+		wpk.TIDcipher, wpk.TIDnonce, wpk.TIDwhiteout,
+		wpk.TIDdelta, wpk.TIDdeltasum, wpk.TIDdeltalen:
+		return true
+	}
+	return false
+}
+
 // Tags identifiers conversion errors.
 var (
 	ErrBadTagKey = errors.New("tag key type is not number or string")
@@ -313,7 +361,7 @@ func TableToTagset(lt *lua.LTable, ts wpk.TagsetRaw) (wpk.TagsetRaw, error) {
 
 		if tid, errk = ValueToTID(k); errk != nil {
 			errs = append(errs, errk)
-		} else if tid == wpk.TIDoffset || tid == wpk.TIDsize || tid == wpk.TIDpath {
+		} else if IsProtected(tid) {
 			errk = &ErrProtected{tid}
 			errs = append(errs, errk)
 		}
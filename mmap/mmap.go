@@ -2,8 +2,11 @@ package mmap
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"io/fs"
 	"os"
+	"sync"
 
 	mm "github.com/edsrzf/mmap-go"
 	"github.com/schwarzlichtbezirk/wpk"
@@ -14,6 +17,10 @@ import (
 // os.Getpagesize() returns incorrect value on Windows.
 const pagesize = 64 * 1024
 
+// ErrNoCopy is error on attempt to get file content without copying
+// when it's not placed at whole mapped package as is.
+var ErrNoCopy = errors.New("file content can not be accessed without copying")
+
 // MappedFile structure gives access to nested into package file by memory mapping.
 // wpk.RFile interface implementation.
 type MappedFile struct {
@@ -54,10 +61,38 @@ func (f *MappedFile) Close() error {
 	return f.Unmap()
 }
 
+// SharedFile structure gives access to nested into package file
+// as to slice of memory mapped whole package.
+// wpk.RFile interface implementation.
+type SharedFile struct {
+	wpk.PkgReader
+	tags wpk.TagsetRaw // has fs.FileInfo interface
+	done sync.Once
+	refs *sync.WaitGroup
+}
+
+// Stat is for fs.File interface compatibility.
+func (f *SharedFile) Stat() (fs.FileInfo, error) {
+	return f.tags, nil
+}
+
+// Close releases reference to mapped memory.
+// io.Closer implementation.
+func (f *SharedFile) Close() error {
+	f.done.Do(f.refs.Done)
+	return nil
+}
+
 // Tagger is object to get access to package nested files
-// by memory mapping of wpk-file.
+// by memory mapping of wpk-file. It maps each opened file,
+// or maps whole package once if it was made by MakeWholeTagger.
 type Tagger struct {
-	fwpk *os.File // open package file descriptor
+	fwpk   *os.File       // open package file descriptor
+	unp    wpk.Unpacker   // decrypts and unpacks files data
+	whole  mm.MMap        // mapped whole package, can be nil
+	refs   sync.WaitGroup // opened files that refer to whole mapped package
+	closed bool
+	mux    sync.RWMutex
 }
 
 // MakeTagger creates Tagger object to get access to package nested files.
@@ -70,16 +105,159 @@ func MakeTagger(fpath string) (wpk.Tagger, error) {
 	return &tgr, nil
 }
 
+// MakeWholeTagger creates Tagger object that maps whole package file once,
+// and gives access to nested files as to slices of this mapping.
+func MakeWholeTagger(fpath string) (wpk.Tagger, error) {
+	var tgr, err = MakeTagger(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var t = tgr.(*Tagger)
+	if t.whole, err = mm.Map(t.fwpk, mm.RDONLY, 0); err != nil {
+		tgr.Close()
+		return nil, err
+	}
+	return tgr, nil
+}
+
+// region returns slice of whole mapped package pointed by tagset.
+func (tgr *Tagger) region(ts wpk.TagsetRaw) ([]byte, error) {
+	var offset, size = ts.Pos()
+	if offset+size > uint(len(tgr.whole)) {
+		return nil, &fs.PathError{Op: "open", Path: ts.Path(), Err: wpk.ErrOutSize}
+	}
+	return tgr.whole[offset : offset+size : offset+size], nil
+}
+
+// SetKey sets the key to decrypt files encrypted by AES-GCM.
+// wpk.KeySetter implementation.
+func (tgr *Tagger) SetKey(key []byte) error {
+	return tgr.unp.SetKey(key)
+}
+
 // OpenTagset creates file object to give access to nested into package file by given tagset.
+// Compressed file is unpacked at once, encrypted file is decrypted by chunks on demand.
+// Returns fs.ErrClosed if tagger was closed.
 func (tgr *Tagger) OpenTagset(ts wpk.TagsetRaw) (wpk.RFile, error) {
-	return NewMappedFile(tgr.fwpk, ts)
+	tgr.mux.RLock()
+	defer tgr.mux.RUnlock()
+	if tgr.closed {
+		return nil, &fs.PathError{Op: "open", Path: ts.Path(), Err: fs.ErrClosed}
+	}
+	if tgr.whole == nil {
+		return tgr.unp.Open(ts, func() (wpk.RFile, error) {
+			return NewMappedFile(tgr.fwpk, ts)
+		})
+	}
+	return tgr.unp.Open(ts, func() (wpk.RFile, error) {
+		var b, err = tgr.region(ts)
+		if err != nil {
+			return nil, err
+		}
+		tgr.refs.Add(1)
+		return &SharedFile{
+			PkgReader: bytes.NewReader(b),
+			tags:      ts,
+			refs:      &tgr.refs,
+		}, nil
+	})
+}
+
+// Bytes returns content of nested file as slice of whole mapped package
+// without copying. It's available only for files that are not compressed,
+// not encrypted and not placed in solid block, and only for tagger made by
+// MakeWholeTagger. Caller should not modify the slice and should not
+// use it after tagger closing.
+func (tgr *Tagger) Bytes(ts wpk.TagsetRaw) ([]byte, error) {
+	tgr.mux.RLock()
+	defer tgr.mux.RUnlock()
+	if tgr.closed {
+		return nil, &fs.PathError{Op: "bytes", Path: ts.Path(), Err: fs.ErrClosed}
+	}
+	if tgr.whole == nil || !israw(ts) {
+		return nil, &fs.PathError{Op: "bytes", Path: ts.Path(), Err: ErrNoCopy}
+	}
+	return tgr.region(ts)
+}
+
+// israw checks up that file data is placed in package as is.
+func israw(ts wpk.TagsetRaw) bool {
+	if method, ok := ts.TagByte(wpk.TIDcomp); ok && method != wpk.CompNone {
+		return false
+	}
+	if alg, ok := ts.TagByte(wpk.TIDcipher); ok && alg != wpk.CipherNone {
+		return false
+	}
+	return !ts.Has(wpk.TIDblock)
+}
+
+// ReadFileNoCopy returns content of nested into package file. If package
+// tagger maps whole package and file data is placed as is, it returns
+// slice of mapped memory without copying, with the same restrictions
+// as Tagger.Bytes has. Otherwise it returns copy of file content.
+func ReadFileNoCopy(pkg *wpk.Package, fkey string) ([]byte, error) {
+	if tgr, ok := pkg.Tagger.(*Tagger); ok {
+		if ts, ok := pkg.GetTagset(fkey); ok {
+			if b, err := tgr.Bytes(ts); err == nil {
+				return b, nil
+			}
+		}
+	}
+	return pkg.ReadFile(fkey)
 }
 
-// Close file handle. This function must be called only for root object,
-// not subdirectories. It has no effect otherwise.
+// Close waits until all files opened on whole mapped package will be closed,
+// then unmaps memory and closes file handle. This function must be called
+// only for root object, not subdirectories. It has no effect otherwise.
 // io.Closer implementation.
-func (tgr *Tagger) Close() error {
+func (tgr *Tagger) Close() (err error) {
+	tgr.mux.Lock()
+	if tgr.closed {
+		tgr.mux.Unlock()
+		return
+	}
+	tgr.closed = true
+	tgr.mux.Unlock()
+
+	tgr.refs.Wait()
+	if tgr.whole != nil {
+		if err = tgr.whole.Unmap(); err != nil {
+			return
+		}
+	}
 	return tgr.fwpk.Close()
 }
 
+// MappedFTT is memory mapped package file with files tags table
+// opened in lazy mode.
+type MappedFTT struct {
+	mm.MMap
+}
+
+// OpenLazy maps whole package file, or tags file of splitted package, and opens
+// given files tags table in lazy mode. Returned closer unmaps the memory,
+// it should be called after package is no longer used.
+func OpenLazy(ftt *wpk.FTT, fpath string) (io.Closer, error) {
+	var f, err = os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mmap mm.MMap
+	if mmap, err = mm.Map(f, mm.RDONLY, 0); err != nil {
+		return nil, err
+	}
+	if err = ftt.OpenLazy(mmap); err != nil {
+		mmap.Unmap()
+		return nil, err
+	}
+	return &MappedFTT{MMap: mmap}, nil
+}
+
+// Close unmaps memory of package file.
+// io.Closer implementation.
+func (m *MappedFTT) Close() error {
+	return m.Unmap()
+}
+
 // The End.
@@ -0,0 +1,75 @@
+package wpk_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/mmap"
+)
+
+// Test zero-copy access to files of whole mapped package,
+// and closing of tagger with opened files.
+func TestWholeTagger(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+	var pkg = packmap(t, testpack1, map[string]string{
+		"raw.txt": "raw content of file",
+	})
+	pkg.Close()
+	if pkg.Tagger, err = mmap.MakeWholeTagger(testpack1); err != nil {
+		t.Fatal(err)
+	}
+	var tgr = pkg.Tagger.(*mmap.Tagger)
+
+	var b []byte
+	if b, err = mmap.ReadFileNoCopy(pkg, "raw.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "raw content of file" {
+		t.Fatal("wrong content of raw file")
+	}
+	var rawts, _ = pkg.GetTagset("raw.txt")
+	var b2, _ = tgr.Bytes(rawts)
+	if &b[0] != &b2[0] {
+		t.Fatal("content of raw file was copied")
+	}
+	var compts = wpk.CopyTagset(rawts).Put(wpk.TIDcomp, []byte{wpk.CompDeflate})
+	if _, err = tgr.Bytes(compts); !errors.Is(err, mmap.ErrNoCopy) {
+		t.Fatalf("expected error on compressed file, got %v", err)
+	}
+
+	// close waits for opened files
+	var f fs.File
+	if f, err = pkg.Open("raw.txt"); err != nil {
+		t.Fatal(err)
+	}
+	var closed = make(chan error)
+	go func() {
+		closed <- pkg.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("tagger is closed with opened file")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if b, err = io.ReadAll(f.(io.Reader)); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "raw content of file" {
+		t.Fatal("wrong content of opened file")
+	}
+	f.Close()
+	if err = <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pkg.Open("raw.txt"); !errors.Is(err, fs.ErrClosed) {
+		t.Fatalf("expected error on closed tagger, got %v", err)
+	}
+}
+
+// The End.
@@ -0,0 +1,183 @@
+package mount
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/schwarzlichtbezirk/wpk"
+)
+
+// FS is file system of package or union of packages to mount.
+// Both wpk.Package and wpk.Union satisfies it.
+type FS interface {
+	fs.StatFS
+	fs.ReadDirFS
+}
+
+// ErrNoReaderAt is error on opened file that does not supports reading at offset.
+var ErrNoReaderAt = errors.New("file does not supports reading at offset")
+
+// Attr is attributes of file or directory of mounted file system.
+type Attr struct {
+	Size  uint64
+	Mode  fs.FileMode
+	Mtime time.Time
+	Atime time.Time
+	Ctime time.Time
+}
+
+// Node is file or directory of mounted file system, that gives
+// file system operations independent from the FUSE implementation.
+type Node struct {
+	fsys    FS
+	fpath   string      // path at file system, "." for root
+	fi      fs.FileInfo // file info, nil for directory
+	dirtime time.Time   // times of directories
+}
+
+// NewRoot returns root directory node of given file system.
+// Directories have no times at package, so they get current time.
+func NewRoot(fsys FS) *Node {
+	return &Node{
+		fsys:    fsys,
+		fpath:   ".",
+		dirtime: time.Now(),
+	}
+}
+
+// child returns node of nested file or directory with given name.
+func (n *Node) child(name string, fi fs.FileInfo) *Node {
+	return &Node{
+		fsys:    n.fsys,
+		fpath:   path.Join(n.fpath, name),
+		fi:      fi,
+		dirtime: n.dirtime,
+	}
+}
+
+// Path returns path of node at file system.
+func (n *Node) Path() string {
+	return n.fpath
+}
+
+// Name returns base name of node.
+func (n *Node) Name() string {
+	return path.Base(n.fpath)
+}
+
+// IsDir returns true for directory node.
+func (n *Node) IsDir() bool {
+	return n.fi == nil
+}
+
+// Lookup returns nested into directory node with given name.
+func (n *Node) Lookup(name string) (*Node, error) {
+	if !n.IsDir() {
+		return nil, &fs.PathError{Op: "lookup", Path: n.fpath, Err: fs.ErrInvalid}
+	}
+	var fpath = path.Join(n.fpath, name)
+	if fi, err := n.fsys.Stat(fpath); err == nil && !fi.IsDir() {
+		return n.child(name, fi), nil
+	}
+	// file is not found, so try to open directory
+	var f, err = n.fsys.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, ok := f.(fs.ReadDirFile); !ok {
+		return nil, &fs.PathError{Op: "lookup", Path: fpath, Err: fs.ErrNotExist}
+	}
+	return n.child(name, nil), nil
+}
+
+// ReadDir returns nested into directory nodes sorted by name.
+func (n *Node) ReadDir() ([]*Node, error) {
+	if !n.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: n.fpath, Err: fs.ErrInvalid}
+	}
+	var list, err = n.fsys.ReadDir(n.fpath)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var nodes = make([]*Node, 0, len(list))
+	for _, de := range list {
+		if de.IsDir() {
+			nodes = append(nodes, n.child(de.Name(), nil))
+			continue
+		}
+		var fi fs.FileInfo
+		if fi, err = de.Info(); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n.child(de.Name(), fi))
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].fpath < nodes[j].fpath
+	})
+	return nodes, nil
+}
+
+// Attr returns attributes of node. File times are taken from
+// tagset if file info has it, and directory times are the mount time.
+func (n *Node) Attr() (attr Attr) {
+	if n.IsDir() {
+		attr.Mode = fs.ModeDir | 0555
+		attr.Mtime, attr.Atime, attr.Ctime = n.dirtime, n.dirtime, n.dirtime
+		return
+	}
+	attr.Size = uint64(n.fi.Size())
+	attr.Mode = 0444
+	attr.Mtime = n.fi.ModTime()
+	attr.Atime, attr.Ctime = attr.Mtime, attr.Mtime
+	if ts, ok := n.fi.Sys().(wpk.TagsetRaw); ok {
+		if t, ok := ts.TagTime(wpk.TIDatime); ok {
+			attr.Atime = t
+		}
+		if t, ok := ts.TagTime(wpk.TIDctime); ok {
+			attr.Ctime = t
+		}
+	}
+	return
+}
+
+// Handle is opened file of mounted file system.
+type Handle struct {
+	f  fs.File
+	ra io.ReaderAt
+}
+
+// Open opens file node to read.
+func (n *Node) Open() (*Handle, error) {
+	if n.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: n.fpath, Err: fs.ErrInvalid}
+	}
+	var f, err = n.fsys.Open(n.fpath)
+	if err != nil {
+		return nil, err
+	}
+	var ra, ok = f.(io.ReaderAt)
+	if !ok {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: n.fpath, Err: ErrNoReaderAt}
+	}
+	return &Handle{f: f, ra: ra}, nil
+}
+
+// ReadAt reads file content at given offset.
+// io.ReaderAt implementation.
+func (h *Handle) ReadAt(b []byte, off int64) (int, error) {
+	return h.ra.ReadAt(b, off)
+}
+
+// Close closes the file.
+// io.Closer implementation.
+func (h *Handle) Close() error {
+	return h.f.Close()
+}
+
+// The End.
@@ -0,0 +1,164 @@
+package mount_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+	"github.com/schwarzlichtbezirk/wpk/mount"
+)
+
+const mediadir = "../testdata/media/"
+
+var testpack1 = wpk.TempPath("testmount1.wpk")
+var testpack2 = wpk.TempPath("testmount2.wpk")
+
+// packfiles makes package with given list of files and opens it.
+func packfiles(t *testing.T, wpkname string, list []string) *wpk.Package {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	if fwpk, err = os.OpenFile(wpkname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetCompress(wpk.CompAll(wpk.CompDeflate))
+	for _, name := range list {
+		var file fs.File
+		if file, err = os.Open(mediadir + name); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = pkg.PackFile(fwpk, file, name); err != nil {
+			file.Close()
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if pkg.Tagger, err = bulk.MakeTagger(wpkname); err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+// walk checks up that nodes tree has the same files as media directory.
+func walk(t *testing.T, n *mount.Node, files map[string]bool) {
+	var list, err = n.ReadDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, child := range list {
+		if i > 0 && list[i-1].Name() >= child.Name() {
+			t.Fatalf("directory '%s' entries are not sorted", n.Path())
+		}
+		var found *mount.Node
+		if found, err = n.Lookup(child.Name()); err != nil {
+			t.Fatal(err)
+		}
+		if found.IsDir() != child.IsDir() || found.Path() != child.Path() {
+			t.Fatalf("lookup of '%s' gives other node", child.Path())
+		}
+		if child.IsDir() {
+			if attr := child.Attr(); !attr.Mode.IsDir() {
+				t.Fatalf("directory '%s' has wrong mode", child.Path())
+			}
+			walk(t, child, files)
+			continue
+		}
+
+		var orig []byte
+		if orig, err = os.ReadFile(mediadir + child.Path()); err != nil {
+			t.Fatal(err)
+		}
+		var attr = child.Attr()
+		if attr.Size != uint64(len(orig)) {
+			t.Fatalf("size of '%s' is %d, expected %d", child.Path(), attr.Size, len(orig))
+		}
+		if attr.Mtime.IsZero() {
+			t.Fatalf("modification time of '%s' is absent", child.Path())
+		}
+
+		var h *mount.Handle
+		if h, err = child.Open(); err != nil {
+			t.Fatal(err)
+		}
+		// read by two chunks from the end to the start
+		var buf = make([]byte, len(orig))
+		var half = len(orig) / 2
+		if _, err = h.ReadAt(buf[half:], int64(half)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = h.ReadAt(buf[:half], 0); err != nil {
+			t.Fatal(err)
+		}
+		h.Close()
+		if !bytes.Equal(buf, orig) {
+			t.Fatalf("content of '%s' is not equal to original", child.Path())
+		}
+		files[child.Path()] = true
+	}
+}
+
+// Test nodes layer of mounted package.
+func TestPackage(t *testing.T) {
+	var list = []string{
+		"bounty.jpg",
+		"img1/claustral.jpg",
+		"img1/Qarataşlar.jpg",
+		"img2/marble.jpg",
+		"img2/Uzuncı.jpg",
+	}
+	defer os.Remove(testpack1)
+	var pkg = packfiles(t, testpack1, list)
+	defer pkg.Close()
+
+	var root = mount.NewRoot(pkg)
+	var files = map[string]bool{}
+	walk(t, root, files)
+	if len(files) != len(list) {
+		t.Fatalf("found %d files, expected %d", len(files), len(list))
+	}
+
+	if _, err := root.Lookup("absent.jpg"); err == nil {
+		t.Fatal("absent file is found")
+	}
+	var dir, err = root.Lookup("img1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dir.Open(); err == nil {
+		t.Fatal("directory should not be opened as file")
+	}
+}
+
+// Test nodes layer of mounted union of packages.
+func TestUnion(t *testing.T) {
+	defer os.Remove(testpack1)
+	defer os.Remove(testpack2)
+	var u = &wpk.Union{
+		List: []*wpk.Package{
+			packfiles(t, testpack1, []string{"bounty.jpg", "img1/claustral.jpg"}),
+			packfiles(t, testpack2, []string{"img1/Qarataşlar.jpg", "img2/marble.jpg"}),
+		},
+	}
+	defer u.Close()
+
+	var files = map[string]bool{}
+	walk(t, mount.NewRoot(u), files)
+	if len(files) != 4 {
+		t.Fatalf("found %d files, expected 4", len(files))
+	}
+}
+
+// The End.
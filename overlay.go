@@ -0,0 +1,551 @@
+package wpk
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schwarzlichtbezirk/wpk/util"
+)
+
+// WhiteoutPrefix is prefix of file names at on-disk upper layer of overlay,
+// that marks deleted files of lower union.
+const WhiteoutPrefix = ".wh."
+
+// ErrWhiteoutName is error on file name with whiteout prefix at overlay.
+var ErrWhiteoutName = errors.New("file name with whiteout prefix is reserved")
+
+// WritableFS is file system that can be modified.
+type WritableFS interface {
+	fs.FS
+	// Create creates or truncates the named file. File content
+	// is committed to file system on close of returned writer.
+	Create(name string) (io.WriteCloser, error)
+	// WriteFile writes data to the named file, creating it if necessary.
+	WriteFile(name string, data []byte) error
+	// Remove removes the named file.
+	Remove(name string) error
+	// Rename renames (moves) file from oldname to newname.
+	Rename(oldname, newname string) error
+}
+
+// ovlNode is file at upper layer of overlay.
+type ovlNode struct {
+	data     []byte    // content of file at in-memory layer
+	size     int64     // size of file
+	mtime    time.Time // modification time
+	whiteout bool      // file is deleted at lower union
+}
+
+// Overlay layers writable in-memory or on-disk directory above union
+// of packages. Files at upper layer hide files with the same name
+// at union, and deleted files of union are hidden by whiteout entries.
+// fs.FS and WritableFS implementation.
+type Overlay struct {
+	Union *Union
+
+	dir   string // directory of upper layer, empty for in-memory layer
+	upper map[string]*ovlNode
+	mux   sync.RWMutex
+}
+
+// NewOverlay returns overlay with in-memory upper layer above given union.
+func NewOverlay(u *Union) *Overlay {
+	return &Overlay{
+		Union: u,
+		upper: map[string]*ovlNode{},
+	}
+}
+
+// OpenOverlay returns overlay with upper layer at given directory above
+// given union. Directory is created if it does not exist, and files
+// that are already present at it, are placed to upper layer.
+// Deleted files are marked by empty files with WhiteoutPrefix at names.
+func OpenOverlay(u *Union, dir string) (o *Overlay, err error) {
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return
+	}
+	o = &Overlay{
+		Union: u,
+		dir:   dir,
+		upper: map[string]*ovlNode{},
+	}
+	err = filepath.WalkDir(dir, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		var rel string
+		if rel, err = filepath.Rel(dir, fpath); err != nil {
+			return err
+		}
+		var fkey = util.ToSlash(rel)
+		var name = path.Base(fkey)
+		if strings.HasPrefix(name, WhiteoutPrefix) {
+			fkey = path.Join(path.Dir(fkey), name[len(WhiteoutPrefix):])
+			o.upper[fkey] = &ovlNode{whiteout: true}
+			return nil
+		}
+		var fi fs.FileInfo
+		if fi, err = d.Info(); err != nil {
+			return err
+		}
+		o.upper[fkey] = &ovlNode{
+			size:  fi.Size(),
+			mtime: fi.ModTime(),
+		}
+		return nil
+	})
+	return
+}
+
+// sysname returns path at OS filesystem of file with given key
+// at on-disk upper layer.
+func (o *Overlay) sysname(fkey string) string {
+	return filepath.Join(o.dir, filepath.FromSlash(fkey))
+}
+
+// whname returns path at OS filesystem of whiteout marker
+// of file with given key at on-disk upper layer.
+func (o *Overlay) whname(fkey string) string {
+	return filepath.Join(o.dir, filepath.FromSlash(path.Dir(fkey)), WhiteoutPrefix+path.Base(fkey))
+}
+
+// tagset returns tagset of file with given key at upper layer.
+func (n *ovlNode) tagset(fkey string) TagsetRaw {
+	return TagsetRaw{}.
+		Put(TIDoffset, UintTag(0)).
+		Put(TIDsize, UintTag(uint(n.size))).
+		Put(TIDpath, StrTag(fkey)).
+		Put(TIDmtime, TimeTag(n.mtime))
+}
+
+// stat returns tagset of file with given key, it looks up upper layer
+// at first, and lower union then. Mutex should be locked by caller.
+func (o *Overlay) stat(fkey string) (TagsetRaw, bool) {
+	if n, ok := o.upper[fkey]; ok {
+		if n.whiteout {
+			return nil, false
+		}
+		return n.tagset(fkey), true
+	}
+	if fi, err := o.Union.Stat(fkey); err == nil && !fi.IsDir() {
+		if ts, ok := fi.Sys().(TagsetRaw); ok {
+			return ts, true
+		}
+	}
+	return nil, false
+}
+
+// keys returns sorted list of all accessible files at overlay.
+// Mutex should be locked by caller.
+func (o *Overlay) keys() (res []string) {
+	for fkey, n := range o.upper {
+		if !n.whiteout {
+			res = append(res, fkey)
+		}
+	}
+	for _, fkey := range o.Union.AllKeys() {
+		if _, ok := o.upper[fkey]; !ok {
+			res = append(res, fkey)
+		}
+	}
+	sort.Strings(res)
+	return
+}
+
+// AllKeys returns sorted list of all accessible files at overlay.
+func (o *Overlay) AllKeys() []string {
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+	return o.keys()
+}
+
+// Stat returns a FileInfo describing the named file or directory.
+// fs.StatFS implementation.
+func (o *Overlay) Stat(fpath string) (fs.FileInfo, error) {
+	fpath = util.ToSlash(fpath)
+	o.mux.RLock()
+	var ts, ok = o.stat(fpath)
+	o.mux.RUnlock()
+	if ok {
+		return ts, nil
+	}
+	if f, err := o.Open(fpath); err == nil {
+		defer f.Close()
+		if _, ok = f.(fs.ReadDirFile); ok {
+			return f.Stat()
+		}
+	}
+	return nil, &fs.PathError{Op: "stat", Path: fpath, Err: fs.ErrNotExist}
+}
+
+// Open implements access to nested into overlay file or directory by keyname.
+// fs.FS implementation.
+func (o *Overlay) Open(dir string) (fs.File, error) {
+	if !validpath(dir) {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrInvalid}
+	}
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+
+	// try to get the file
+	if n, ok := o.upper[dir]; ok && !n.whiteout {
+		if o.dir != "" {
+			return os.Open(o.sysname(dir))
+		}
+		return &ovlFile{
+			TagsetRaw: n.tagset(dir),
+			Reader:    bytes.NewReader(n.data),
+		}, nil
+	} else if !ok {
+		if _, is := o.stat(dir); is {
+			return o.Union.Open(dir)
+		}
+	}
+
+	// try to get the folder
+	var prefix string
+	if dir != "." {
+		prefix = dir + "/" // set terminated slash
+	}
+	for _, fkey := range o.keys() {
+		if strings.HasPrefix(fkey, prefix) {
+			return &ovlDir{
+				TagsetRaw: TagsetRaw{}.Put(TIDpath, StrTag(dir)),
+				o:         o,
+			}, nil
+		}
+	}
+	// on case if not found
+	return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
+}
+
+// ReadFile returns slice with nested into overlay file content.
+// fs.ReadFileFS implementation.
+func (o *Overlay) ReadFile(fpath string) ([]byte, error) {
+	if !validpath(fpath) {
+		return nil, &fs.PathError{Op: "readfile", Path: fpath, Err: fs.ErrInvalid}
+	}
+	o.mux.RLock()
+	var n, ok = o.upper[fpath]
+	o.mux.RUnlock()
+	if ok {
+		if n.whiteout {
+			return nil, &fs.PathError{Op: "readfile", Path: fpath, Err: fs.ErrNotExist}
+		}
+		if o.dir != "" {
+			return os.ReadFile(o.sysname(fpath))
+		}
+		return bytes.Clone(n.data), nil
+	}
+	return o.Union.ReadFile(fpath)
+}
+
+// ReadDir reads the named directory
+// and returns a list of directory entries sorted by filename.
+// fs.ReadDirFS interface implementation.
+func (o *Overlay) ReadDir(dir string) (list []fs.DirEntry, err error) {
+	dir = util.ToSlash(dir)
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+
+	var prefix string
+	if dir != "." && dir != "" {
+		prefix = dir + "/" // set terminated slash
+	}
+	var found = map[string]Void{}
+	for _, fkey := range o.keys() {
+		if !strings.HasPrefix(fkey, prefix) {
+			continue
+		}
+		var suffix = fkey[len(prefix):]
+		if sp := strings.IndexByte(suffix, '/'); sp >= 0 { // dir detected
+			var name = suffix[:sp]
+			if _, ok := found[name]; !ok {
+				found[name] = Void{}
+				list = append(list, TagsetRaw{}.Put(TIDpath, StrTag(prefix+name)))
+			}
+			continue
+		}
+		if ts, ok := o.stat(fkey); ok { // file detected
+			found[suffix] = Void{}
+			list = append(list, ts)
+		}
+	}
+	sortdir(list)
+	return
+}
+
+// put places file with given content to upper layer.
+func (o *Overlay) put(fkey string, data []byte, mtime time.Time) error {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	return o.putnode(fkey, data, mtime)
+}
+
+// putnode places file with given content to upper layer.
+// Mutex should be locked by caller.
+func (o *Overlay) putnode(fkey string, data []byte, mtime time.Time) (err error) {
+	var n = &ovlNode{
+		size:  int64(len(data)),
+		mtime: mtime,
+	}
+	if o.dir != "" {
+		var fpath = o.sysname(fkey)
+		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+			return
+		}
+		if err = os.WriteFile(fpath, data, 0644); err != nil {
+			return
+		}
+		if err = os.Chtimes(fpath, mtime, mtime); err != nil {
+			return
+		}
+		if err = os.Remove(o.whname(fkey)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+		err = nil
+	} else {
+		n.data = data
+	}
+	o.upper[fkey] = n
+	return
+}
+
+// checkname returns error if given name can not be used for file at overlay.
+func checkname(op, name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if strings.HasPrefix(path.Base(name), WhiteoutPrefix) {
+		return &fs.PathError{Op: op, Path: name, Err: ErrWhiteoutName}
+	}
+	return nil
+}
+
+// WriteFile writes data to the named file at upper layer.
+// WritableFS implementation.
+func (o *Overlay) WriteFile(name string, data []byte) error {
+	if err := checkname("writefile", name); err != nil {
+		return err
+	}
+	return o.put(name, bytes.Clone(data), time.Now())
+}
+
+// Create returns writer to the named file at upper layer.
+// File content is committed on writer close.
+// WritableFS implementation.
+func (o *Overlay) Create(name string) (io.WriteCloser, error) {
+	if err := checkname("create", name); err != nil {
+		return nil, err
+	}
+	return &ovlWriter{o: o, fkey: name}, nil
+}
+
+// Remove removes the named file. File at lower union
+// is hidden by whiteout entry at upper layer.
+// WritableFS implementation.
+func (o *Overlay) Remove(name string) (err error) {
+	if err = checkname("remove", name); err != nil {
+		return
+	}
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	var n, inupper = o.upper[name]
+	if inupper && n.whiteout {
+		inupper = false
+	}
+	var inlower bool
+	if fi, err := o.Union.Stat(name); err == nil && !fi.IsDir() {
+		inlower = true
+	}
+	if !inupper && !inlower {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if o.dir != "" && inupper {
+		if err = os.Remove(o.sysname(name)); err != nil {
+			return
+		}
+	}
+	return o.hide(name, inlower)
+}
+
+// hide removes file with given key from upper layer, and puts whiteout
+// entry for it if file is present at lower union.
+// Mutex should be locked by caller.
+func (o *Overlay) hide(fkey string, inlower bool) (err error) {
+	if !inlower {
+		delete(o.upper, fkey)
+		return
+	}
+	if o.dir != "" {
+		var whpath = o.whname(fkey)
+		if err = os.MkdirAll(filepath.Dir(whpath), os.ModePerm); err != nil {
+			return
+		}
+		if err = os.WriteFile(whpath, nil, 0644); err != nil {
+			return
+		}
+	}
+	o.upper[fkey] = &ovlNode{whiteout: true}
+	return
+}
+
+// Rename renames file from oldname to newname.
+// Modification time of file is kept. File at upper layer is moved
+// as is, file at lower union is copied to upper layer and hidden.
+// WritableFS implementation.
+func (o *Overlay) Rename(oldname, newname string) (err error) {
+	if err = checkname("rename", oldname); err != nil {
+		return
+	}
+	if err = checkname("rename", newname); err != nil {
+		return
+	}
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	var ts, ok = o.stat(oldname)
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	if oldname == newname {
+		return
+	}
+	if n, inupper := o.upper[oldname]; inupper {
+		if o.dir != "" {
+			var fpath = o.sysname(newname)
+			if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+				return
+			}
+			if err = os.Rename(o.sysname(oldname), fpath); err != nil {
+				return
+			}
+			if err = os.Remove(o.whname(newname)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return
+			}
+			err = nil
+		}
+		o.upper[newname] = n
+	} else {
+		var data []byte
+		if data, err = o.Union.ReadFile(oldname); err != nil {
+			return
+		}
+		if err = o.putnode(newname, data, ts.ModTime()); err != nil {
+			return
+		}
+	}
+	var inlower bool
+	if fi, err := o.Union.Stat(oldname); err == nil && !fi.IsDir() {
+		inlower = true
+	}
+	return o.hide(oldname, inlower)
+}
+
+// Flush puts all files of upper layer into package with whiteout entries
+// for deleted files. Package placed first at union list reproduces overlay.
+// Package should be started by Begin and finalized by Sync by caller.
+func (o *Overlay) Flush(w io.WriteSeeker, pkg *Package) (err error) {
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+
+	var keys = make([]string, 0, len(o.upper))
+	for fkey := range o.upper {
+		keys = append(keys, fkey)
+	}
+	sort.Strings(keys)
+	for _, fkey := range keys {
+		var n = o.upper[fkey]
+		if n.whiteout {
+			pkg.PutWhiteout(fkey)
+			continue
+		}
+		var data = n.data
+		if o.dir != "" {
+			if data, err = os.ReadFile(o.sysname(fkey)); err != nil {
+				return
+			}
+		}
+		var ts TagsetRaw
+		if ts, err = pkg.PackData(w, bytes.NewReader(data), fkey); err != nil {
+			return
+		}
+		if err = pkg.SetTagset(fkey, ts.Put(TIDmtime, TimeTag(n.mtime))); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ovlFile is opened file of in-memory upper layer.
+type ovlFile struct {
+	TagsetRaw
+	*bytes.Reader
+}
+
+// Stat is fs.File implementation.
+func (f *ovlFile) Stat() (fs.FileInfo, error) {
+	return f.TagsetRaw, nil
+}
+
+// Close is fs.File implementation.
+func (f *ovlFile) Close() error {
+	return nil
+}
+
+// ovlDir is directory of overlay.
+// fs.ReadDirFile interface implementation.
+type ovlDir struct {
+	TagsetRaw
+	o     *Overlay
+	pager dirpager
+}
+
+// fs.ReadDirFile interface implementation.
+func (f *ovlDir) Stat() (fs.FileInfo, error) {
+	return f, nil
+}
+
+// fs.ReadDirFile interface implementation.
+func (f *ovlDir) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+// fs.ReadDirFile interface implementation.
+func (f *ovlDir) Close() error {
+	return nil
+}
+
+// fs.ReadDirFile interface implementation.
+func (f *ovlDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	return f.pager.next(n, func() ([]fs.DirEntry, error) {
+		return f.o.ReadDir(f.Path())
+	})
+}
+
+// ovlWriter is writer to file of upper layer,
+// that commits file content on close.
+type ovlWriter struct {
+	bytes.Buffer
+	o    *Overlay
+	fkey string
+}
+
+// Close commits written content to upper layer.
+// io.Closer implementation.
+func (w *ovlWriter) Close() error {
+	return w.o.put(w.fkey, w.Bytes(), time.Now())
+}
+
+// The End.
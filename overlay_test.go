@@ -0,0 +1,182 @@
+package wpk_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+)
+
+var testpatch = wpk.TempPath("testpatch.wpk")
+
+// modify makes changes at overlay and checks up its content.
+func modify(t *testing.T, o *wpk.Overlay) {
+	var err error
+	var newdata = []byte("new file content")
+	if err = o.WriteFile("img1/new.txt", newdata); err != nil {
+		t.Fatal(err)
+	}
+	// rename to itself keeps the file
+	if err = o.Rename("img1/new.txt", "img1/new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// move file of upper layer forth and back
+	if err = o.Rename("img1/new.txt", "img4/new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Rename("img4/new.txt", "img1/new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := o.ReadFile("img1/new.txt"); err != nil || !bytes.Equal(b, newdata) {
+		t.Fatalf("content of moved file is changed, error %v", err)
+	}
+	if _, err = o.Stat("img4/new.txt"); err == nil {
+		t.Fatal("moved file is found by old name")
+	}
+	var w, _ = o.Create("bounty.jpg")
+	w.Write(newdata)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Remove("img1/claustral.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Rename("img2/marble.jpg", "img3/marble.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Remove("absent.jpg"); err == nil {
+		t.Fatal("absent file should not be removed")
+	}
+	if err = o.WriteFile("img1/"+wpk.WhiteoutPrefix+"x", nil); err == nil {
+		t.Fatal("file with whiteout prefix should not be created")
+	}
+	checkfs(t, o)
+}
+
+// checkfs checks up that file system has content of modified overlay.
+func checkfs(t *testing.T, fsys fs.FS) {
+	var b, err = fs.ReadFile(fsys, "bounty.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "new file content" {
+		t.Fatal("content of overwritten file is not changed")
+	}
+	if _, err = fs.Stat(fsys, "img1/claustral.jpg"); err == nil {
+		t.Fatal("removed file is found")
+	}
+	if _, err = fs.Stat(fsys, "img2/marble.jpg"); err == nil {
+		t.Fatal("renamed file is found by old name")
+	}
+	var orig []byte
+	if orig, err = os.ReadFile(mediadir + "img2/marble.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = fs.ReadFile(fsys, "img3/marble.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, orig) {
+		t.Fatal("content of renamed file is not equal to original")
+	}
+	var list []fs.DirEntry
+	if list, err = fs.ReadDir(fsys, "img1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 entries at 'img1' directory, got %d", len(list))
+	}
+	if list, _ = fs.ReadDir(fsys, "img2"); len(list) != 0 {
+		t.Fatal("directory with all removed files has entries")
+	}
+	if _, err = fsys.Open("img2"); err == nil {
+		t.Fatal("directory with all removed files is opened")
+	}
+}
+
+// overlay returns union of test package to make overlay above it.
+func overlay(t *testing.T) *wpk.Union {
+	PackFiles(t, testpack1, []string{
+		"bounty.jpg",
+		"img1/claustral.jpg",
+		"img1/Qarataşlar.jpg",
+		"img2/marble.jpg",
+	})
+	var err error
+	var pkg = wpk.NewPackage()
+	if err = pkg.OpenFile(testpack1); err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Tagger, err = bulk.MakeTagger(testpack1); err != nil {
+		t.Fatal(err)
+	}
+	return &wpk.Union{List: []*wpk.Package{pkg}}
+}
+
+// Test in-memory overlay and patch package flushed from it.
+func TestOverlay(t *testing.T) {
+	defer os.Remove(testpack1)
+	defer os.Remove(testpatch)
+
+	var u = overlay(t)
+	defer u.Close()
+	var o = wpk.NewOverlay(u)
+	modify(t, o)
+
+	// flush overlay into patch package
+	var err error
+	var fwpk *os.File
+	var patch = wpk.NewPackage()
+	if fwpk, err = os.OpenFile(testpatch, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+	if err = patch.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Flush(fwpk, patch); err != nil {
+		t.Fatal(err)
+	}
+	if err = patch.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// open patch package and place it above original package
+	patch = wpk.NewPackage()
+	if err = patch.OpenFile(testpatch); err != nil {
+		t.Fatal(err)
+	}
+	if patch.Tagger, err = bulk.MakeTagger(testpatch); err != nil {
+		t.Fatal(err)
+	}
+	defer patch.Close()
+	var pu = &wpk.Union{List: []*wpk.Package{patch, u.List[0]}}
+	checkfs(t, pu)
+	if keys1, keys2 := o.AllKeys(), pu.AllKeys(); len(keys1) != len(keys2) {
+		t.Fatalf("patched union has %d files, overlay has %d", len(keys2), len(keys1))
+	}
+}
+
+// Test overlay with upper layer at OS filesystem.
+func TestOverlayDisk(t *testing.T) {
+	defer os.Remove(testpack1)
+
+	var u = overlay(t)
+	defer u.Close()
+	var dir = t.TempDir()
+	var o, err = wpk.OpenOverlay(u, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modify(t, o)
+
+	// reopen upper layer
+	if o, err = wpk.OpenOverlay(u, dir); err != nil {
+		t.Fatal(err)
+	}
+	checkfs(t, o)
+}
+
+// The End.
@@ -0,0 +1,206 @@
+package wpk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"io/fs"
+	"runtime"
+	"sync"
+)
+
+// PackSource is file to be packed by parallel packer.
+type PackSource struct {
+	Key  string                  // file key at package
+	Open func() (fs.File, error) // opens file to read its content and times
+}
+
+// DefBufSize is default maximum size of file content that is buffered
+// by parallel packer worker.
+const DefBufSize = 4 * 1024 * 1024
+
+// ParallelOpts is settings of parallel packer.
+type ParallelOpts struct {
+	Workers int    // number of workers, GOMAXPROCS value if zero
+	BufSize int64  // files greater than it are streamed on writing without buffering, DefBufSize if zero
+	Hashes  []TID  // hash tags to compute for each file
+	Secret  []byte // HMAC key for MD5 and SHA digests
+}
+
+// prepared is file content prepared by worker to be written to package.
+type prepared struct {
+	data   []byte            // original content
+	comp   []byte            // compressed content if method is not CompNone
+	method byte              // compression method
+	sum    [sha256.Size]byte // content digest for deduplication
+	tags   TagsetRaw         // times and hash tags
+	stream bool              // content is too big to be buffered, and should be streamed
+	err    error
+}
+
+// prepare reads the file, computes hash tags and compresses the content.
+// Content of file greater than buffer size is not read, such file
+// is streamed by packstream.
+func prepare(src PackSource, method byte, repro reproState, opts *ParallelOpts) (p *prepared) {
+	p = &prepared{method: method}
+	var f, err = src.Open()
+	if err != nil {
+		p.err = err
+		return
+	}
+	defer f.Close()
+
+	var fi fs.FileInfo
+	if fi, err = f.Stat(); err != nil {
+		p.err = err
+		return
+	}
+	p.tags = repro.puttimes(p.tags, fi)
+	if fi.Size() > opts.BufSize {
+		p.stream = true
+		return
+	}
+	if p.data, err = io.ReadAll(f); err != nil {
+		p.err = err
+		return
+	}
+	for _, tid := range opts.Hashes {
+		if h := NewTagHash(tid, opts.Secret); h != nil {
+			h.Write(p.data)
+			p.tags = p.tags.Put(tid, h.Sum(nil))
+		}
+	}
+	p.sum = sha256.Sum256(p.data)
+	if method != CompNone {
+		var buf bytes.Buffer
+		if _, _, err = CompressTo(&buf, bytes.NewReader(p.data), method); err != nil {
+			p.err = err
+			return
+		}
+		p.comp = buf.Bytes()
+	}
+	return
+}
+
+// packstream puts content of big file into package by streaming,
+// and computes hash tags on the fly.
+func (pkg *Package) packstream(w io.WriteSeeker, src PackSource, p *prepared, opts *ParallelOpts) (ts TagsetRaw, err error) {
+	var f fs.File
+	if f, err = src.Open(); err != nil {
+		return
+	}
+	defer f.Close()
+
+	var tids []TID
+	var hl []io.Writer
+	for _, tid := range opts.Hashes {
+		if h := NewTagHash(tid, opts.Secret); h != nil {
+			tids = append(tids, tid)
+			hl = append(hl, h)
+		}
+	}
+	var r io.Reader = f
+	if len(hl) > 0 {
+		r = io.TeeReader(f, io.MultiWriter(hl...))
+	}
+	if ts, err = pkg.packdata(w, r, src.Key, nil); err != nil {
+		return
+	}
+	for i, tid := range tids {
+		p.tags = p.tags.Put(tid, hl[i].(hash.Hash).Sum(nil))
+	}
+	return
+}
+
+// PackParallel puts given files into package. Files are read, hashed and
+// compressed by pool of workers, and written by the calling goroutine in
+// order of the list, so package content does not depend on number of
+// workers, except for encrypted files with random nonces. In reproducible
+// build mode files are written in order of keys. Files greater
+// than buffer size are not buffered by workers, and streamed at writing.
+// Given callback is called for each written file in the same order,
+// and can be nil.
+func (pkg *Package) PackParallel(w io.WriteSeeker, list []PackSource, opts ParallelOpts, done func(fkey string, ts TagsetRaw) error) (err error) {
+	var workers = opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.BufSize <= 0 {
+		opts.BufSize = DefBufSize
+	}
+	pkg.mux.Lock()
+	var comp, repro = pkg.comp, pkg.repro
+	pkg.mux.Unlock()
+	list = repro.sortlist(list)
+
+	var slots = make([]chan *prepared, len(list))
+	for i := range slots {
+		slots[i] = make(chan *prepared, 1)
+	}
+	// number of prepared but not written files is limited
+	var sem = make(chan struct{}, 2*workers)
+	var quit = make(chan struct{})
+	var idxch = make(chan int)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(quit)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(idxch)
+		for i := range list {
+			select {
+			case sem <- struct{}{}:
+			case <-quit:
+				return
+			}
+			select {
+			case idxch <- i:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	for n := workers; n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxch {
+				var method = CompNone
+				if comp != nil {
+					method = comp(list[i].Key)
+				}
+				slots[i] <- prepare(list[i], method, repro, &opts)
+			}
+		}()
+	}
+
+	for i, src := range list {
+		var p = <-slots[i]
+		<-sem
+		if p.err != nil {
+			return &fs.PathError{Op: "packparallel", Path: src.Key, Err: p.err}
+		}
+		var ts TagsetRaw
+		if p.stream {
+			ts, err = pkg.packstream(w, src, p, &opts)
+		} else {
+			ts, err = pkg.packdata(w, nil, src.Key, p)
+		}
+		if err != nil {
+			return
+		}
+		ts = append(CopyTagset(ts), p.tags...)
+		pkg.SetTagset(src.Key, ts)
+		if done != nil {
+			if err = done(src.Key, ts); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// The End.
@@ -0,0 +1,118 @@
+package wpk_test
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+	"github.com/schwarzlichtbezirk/wpk/util"
+)
+
+// Test parallel packing gives the same data placement for any number
+// of workers and for streamed big files, and packed files pass
+// verification by hash tags.
+func TestParallel(t *testing.T) {
+	var err error
+	var secret = []byte("parallel secret")
+	var list []wpk.PackSource
+	fs.WalkDir(os.DirFS(mediadir), ".", func(fkey string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		var fpath = util.JoinPath(mediadir, fkey)
+		list = append(list, wpk.PackSource{
+			Key: fkey,
+			Open: func() (fs.File, error) {
+				return os.Open(fpath)
+			},
+		})
+		return nil
+	})
+	var opts = wpk.ParallelOpts{
+		Hashes: []wpk.TID{wpk.TIDcrc32c, wpk.TIDsha256},
+		Secret: secret,
+	}
+
+	var makepkg = func(fname string, workers int, bufsize int64) (pkg *wpk.Package) {
+		var fwpk *os.File
+		pkg = wpk.NewPackage()
+		if fwpk, err = os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer fwpk.Close()
+
+		if err = pkg.Begin(fwpk, nil); err != nil {
+			t.Fatal(err)
+		}
+		pkg.SetCompress(wpk.CompByMIME(wpk.CompDeflate))
+		opts.Workers, opts.BufSize = workers, bufsize
+		var count int
+		if err = pkg.PackParallel(fwpk, list, opts, func(fkey string, ts wpk.TagsetRaw) error {
+			if fkey != list[count].Key {
+				t.Fatalf("file '%s' written out of order, expected '%s'", fkey, list[count].Key)
+			}
+			count++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if count != len(list) {
+			t.Fatalf("expected %d files written, got %d", len(list), count)
+		}
+		if err = pkg.Sync(fwpk, nil); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	defer os.Remove(testpack)
+	defer os.Remove(testpkgt)
+	defer os.Remove(testpack1)
+	var pkg1 = makepkg(testpack, 1, 0)
+	var pkg4 = makepkg(testpkgt, 4, 0)
+	var pkgs = makepkg(testpack1, 4, 1024) // most of files are streamed
+
+	for fname, pkg := range map[string]*wpk.Package{
+		testpkgt:  pkg4,
+		testpack1: pkgs,
+	} {
+		if pkg1.DataSize() != pkg.DataSize() {
+			t.Fatalf("data size %d differs from %d", pkg.DataSize(), pkg1.DataSize())
+		}
+		for _, src := range list {
+			var ts1, _ = pkg1.GetTagset(src.Key)
+			var ts, ok = pkg.GetTagset(src.Key)
+			if !ok {
+				t.Fatalf("file '%s' is absent", src.Key)
+			}
+			var off1, size1 = ts1.Pos()
+			var off, size = ts.Pos()
+			if off1 != off || size1 != size {
+				t.Fatalf("placement of '%s' depends on packing mode", src.Key)
+			}
+		}
+
+		// verify content
+		if pkg.Tagger, err = bulk.MakeTagger(fname); err != nil {
+			t.Fatal(err)
+		}
+		defer pkg.Close()
+		var res []wpk.VerifyResult
+		if res, err = pkg.Verify(context.Background(), secret); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range res {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			if r.Checked != 2 {
+				t.Fatalf("expected 2 hash tags checked for '%s', got %d", r.Key, r.Checked)
+			}
+		}
+	}
+}
+
+// The End.
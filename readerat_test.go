@@ -0,0 +1,128 @@
+package wpk_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+	"github.com/schwarzlichtbezirk/wpk/fsys"
+)
+
+// Test package opened from random-access sources.
+func TestReaderAt(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+	defer os.Remove(testpack2)
+	var files = map[string]string{
+		"file1.txt":     "content of first file",
+		"dir/file2.txt": "content of second file",
+	}
+	var pkg = packmap(t, testpack1, files)
+	pkg.Close()
+
+	var b []byte
+	if b, err = os.ReadFile(testpack1); err != nil {
+		t.Fatal(err)
+	}
+	// package is embedded into larger file after some prefix
+	var prefix = bytes.Repeat([]byte("prefix"), 100)
+	if err = os.WriteFile(testpack2, append(append(prefix, b...), "suffix"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var f *os.File
+	if f, err = os.Open(testpack2); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for name, r := range map[string]io.ReaderAt{
+		"memory":  bytes.NewReader(b),
+		"section": io.NewSectionReader(f, int64(len(prefix)), int64(len(b))),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var pkg = wpk.NewPackage()
+			if err = pkg.OpenReaderAt(r, int64(len(b))); err != nil {
+				t.Fatal(err)
+			}
+			if pkg.Tagger, err = fsys.MakeTaggerAt(r, int64(len(b))); err != nil {
+				t.Fatal(err)
+			}
+			for fkey, content := range files {
+				var data []byte
+				if data, err = pkg.ReadFile(fkey); err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != content {
+					t.Fatalf("wrong content of file '%s'", fkey)
+				}
+			}
+			var f fs.File
+			if f, err = pkg.Open("file1.txt"); err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err = pkg.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = pkg.ReadFile("file1.txt"); err == nil {
+				t.Fatal("file is read after tagger closing")
+			}
+			if _, err = io.ReadAll(f); !errors.Is(err, fs.ErrClosed) {
+				t.Fatalf("expected error on reading of file opened before tagger closing, got %v", err)
+			}
+		})
+	}
+
+	// source size is less than package
+	if err = wpk.NewPackage().OpenReaderAt(bytes.NewReader(b), int64(len(b)/2)); err == nil {
+		t.Fatal("truncated package is opened")
+	}
+	// source content is shorter than given size
+	if _, err = bulk.MakeTaggerAt(bytes.NewReader(b), int64(len(b)+1)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected error on short source, got %v", err)
+	}
+}
+
+// Test tagger of package file that grows by files appended after tagger creation.
+func TestTaggerAppend(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+	var pkg = packmap(t, testpack1, map[string]string{
+		"file1.txt": "content of first file",
+	})
+	pkg.Close()
+	if pkg.Tagger, err = fsys.MakeTagger(testpack1); err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.Close()
+
+	var fwpk *os.File
+	if fwpk, err = os.OpenFile(testpack1, os.O_RDWR, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+	if err = pkg.Append(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pkg.PackData(fwpk, bytes.NewReader([]byte("content of second file")), "file2.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var data []byte
+	if data, err = pkg.ReadFile("file2.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "content of second file" {
+		t.Fatal("wrong content of appended file")
+	}
+}
+
+// The End.
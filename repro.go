@@ -0,0 +1,109 @@
+package wpk
+
+import (
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/djherbis/times.v1"
+)
+
+// ReproEpoch is time that all modification times are clamped to
+// in reproducible build mode if other epoch is not given.
+var ReproEpoch = time.Unix(0, 0).UTC()
+
+// reproState is reproducible build settings of package writer.
+type reproState struct {
+	on    bool      // sort files tags table and omit volatile times
+	epoch time.Time // modification times later than epoch are clamped to it
+}
+
+// SetReproducible turns on or off reproducible build mode. In this mode
+// files tags table is sorted by file keys on sync, files are written
+// by PackParallel in order of keys, and only modification time is stored
+// for packed files, so packing of the same files produces identical package.
+// Later modification times are clamped to given epoch, or to ReproEpoch
+// if epoch is zero, so file times does not depend on checkout time.
+// Encrypted files are not reproducible due to random nonces.
+func (ftt *FTT) SetReproducible(on bool, epoch time.Time) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	if epoch.IsZero() {
+		epoch = ReproEpoch
+	}
+	ftt.repro = reproState{on: on, epoch: epoch}
+}
+
+// IsReproducible returns true if reproducible build mode is on.
+func (ftt *FTT) IsReproducible() bool {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	return ftt.repro.on
+}
+
+// SourceDateEpoch returns time given by SOURCE_DATE_EPOCH environment
+// variable as UNIX time in seconds, or zero time if it is not set.
+func SourceDateEpoch() (t time.Time, err error) {
+	var str = os.Getenv("SOURCE_DATE_EPOCH")
+	if str == "" {
+		return
+	}
+	var sec int64
+	if sec, err = strconv.ParseInt(str, 10, 64); err != nil {
+		return
+	}
+	t = time.Unix(sec, 0)
+	return
+}
+
+// puttimes puts file times tags from given file info.
+// Only modification time is present for files that are not at OS filesystem.
+func (rs reproState) puttimes(ts TagsetRaw, fi fs.FileInfo) TagsetRaw {
+	if rs.on {
+		var mtime = fi.ModTime()
+		if mtime.After(rs.epoch) {
+			mtime = rs.epoch
+		}
+		return ts.Put(TIDmtime, TimeTag(mtime))
+	}
+	if fi.Sys() == nil {
+		return ts.Put(TIDmtime, TimeTag(fi.ModTime()))
+	}
+	var tsp = times.Get(fi)
+	ts = ts.Put(TIDmtime, TimeTag(tsp.ModTime()))
+	ts = ts.Put(TIDatime, TimeTag(tsp.AccessTime()))
+	if tsp.HasChangeTime() {
+		ts = ts.Put(TIDctime, TimeTag(tsp.ChangeTime()))
+	}
+	if tsp.HasBirthTime() {
+		ts = ts.Put(TIDbtime, TimeTag(tsp.BirthTime()))
+	}
+	return ts
+}
+
+// sortlist returns copy of given list sorted by file keys
+// in reproducible build mode, or the list as is otherwise.
+func (rs reproState) sortlist(list []PackSource) []PackSource {
+	if !rs.on {
+		return list
+	}
+	list = append([]PackSource(nil), list...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// sortkeys reorders files tags table by file keys in reproducible
+// build mode. Mutex should be locked by caller.
+func (ftt *FTT) sortkeys() {
+	if ftt.repro.on {
+		ftt.tsm.Sort(func(a, b string) bool {
+			return a < b
+		})
+	}
+}
+
+// The End.
@@ -0,0 +1,158 @@
+package wpk_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/schwarzlichtbezirk/wpk"
+)
+
+// Test reproducible build gives identical packages with sorted files
+// tags table and clamped modification times.
+func TestReproducible(t *testing.T) {
+	var err error
+	var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var list []string
+	fs.WalkDir(os.DirFS(mediadir), ".", func(fkey string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		list = append(list, fkey)
+		return nil
+	})
+
+	var makepkg = func(fname string) (pkg *wpk.Package) {
+		var fwpk *os.File
+		pkg = wpk.NewPackage()
+		if fwpk, err = os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer fwpk.Close()
+
+		if err = pkg.Begin(fwpk, nil); err != nil {
+			t.Fatal(err)
+		}
+		pkg.SetReproducible(true, epoch)
+		// pack in reverse order to check up sorting
+		for i := len(list) - 1; i >= 0; i-- {
+			var file fs.File
+			if file, err = os.Open(mediadir + list[i]); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = pkg.PackFile(fwpk, file, list[i]); err != nil {
+				file.Close()
+				t.Fatal(err)
+			}
+			file.Close()
+		}
+		if err = pkg.Sync(fwpk, nil); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	var fname1, fname2 = wpk.TempPath("repro1.wpk"), wpk.TempPath("repro2.wpk")
+	defer os.Remove(fname1)
+	defer os.Remove(fname2)
+	var pkg = makepkg(fname1)
+	makepkg(fname2)
+
+	var b1, b2 []byte
+	if b1, err = os.ReadFile(fname1); err != nil {
+		t.Fatal(err)
+	}
+	if b2, err = os.ReadFile(fname2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b1, b2) {
+		t.Fatal("packages built in reproducible mode are not identical")
+	}
+
+	var prev string
+	pkg.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		if fkey < prev {
+			t.Fatalf("file '%s' is not in sorted order after '%s'", fkey, prev)
+		}
+		prev = fkey
+		if ts.Has(wpk.TIDatime) || ts.Has(wpk.TIDctime) || ts.Has(wpk.TIDbtime) {
+			t.Fatalf("file '%s' has volatile time tags", fkey)
+		}
+		if mtime, ok := ts.TagTime(wpk.TIDmtime); !ok || mtime.After(epoch) {
+			t.Fatalf("modification time of '%s' is not clamped to epoch", fkey)
+		}
+		return true
+	})
+}
+
+// Test parallel packing in reproducible mode gives identical packages
+// for any order of files, and times are clamped to default epoch.
+func TestReproParallel(t *testing.T) {
+	var err error
+	var list []wpk.PackSource
+	fs.WalkDir(os.DirFS(mediadir), ".", func(fkey string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		var fpath = mediadir + fkey
+		list = append(list, wpk.PackSource{
+			Key: fkey,
+			Open: func() (fs.File, error) {
+				return os.Open(fpath)
+			},
+		})
+		return nil
+	})
+	var reversed = make([]wpk.PackSource, len(list))
+	for i, src := range list {
+		reversed[len(list)-1-i] = src
+	}
+
+	var makepkg = func(fname string, list []wpk.PackSource) (pkg *wpk.Package) {
+		var fwpk *os.File
+		pkg = wpk.NewPackage()
+		if fwpk, err = os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer fwpk.Close()
+
+		if err = pkg.Begin(fwpk, nil); err != nil {
+			t.Fatal(err)
+		}
+		pkg.SetReproducible(true, time.Time{})
+		if err = pkg.PackParallel(fwpk, list, wpk.ParallelOpts{Workers: 2}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err = pkg.Sync(fwpk, nil); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	var fname1, fname2 = wpk.TempPath("repro1.wpk"), wpk.TempPath("repro2.wpk")
+	defer os.Remove(fname1)
+	defer os.Remove(fname2)
+	var pkg = makepkg(fname1, list)
+	makepkg(fname2, reversed)
+
+	var b1, b2 []byte
+	if b1, err = os.ReadFile(fname1); err != nil {
+		t.Fatal(err)
+	}
+	if b2, err = os.ReadFile(fname2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b1, b2) {
+		t.Fatal("packages built in reproducible mode from files in different order are not identical")
+	}
+	pkg.Enum(func(fkey string, ts wpk.TagsetRaw) bool {
+		if mtime, ok := ts.TagTime(wpk.TIDmtime); !ok || !mtime.Equal(wpk.ReproEpoch) {
+			t.Fatalf("modification time of '%s' is not set to default epoch", fkey)
+		}
+		return true
+	})
+}
+
+// The End.
@@ -0,0 +1,134 @@
+package wpk
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/schwarzlichtbezirk/wpk/util"
+)
+
+const (
+	TrailerSign = "WPK-TAIL" // signature at the end of package trailer
+	TrailerSize = 16         // package trailer size in bytes
+)
+
+// ErrNoTrailer is error on host file without package trailer at the end.
+var ErrNoTrailer = errors.New("package trailer is not found at the end of file")
+
+// SetTrailer turns on or off writing of trailer at the end of single file
+// package on sync. Trailer records package size, so package with trailer
+// can be appended to any host file, such as executable, and found by
+// FindTrailer. All offsets of package are relative to package start.
+func (ftt *FTT) SetTrailer(on bool) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	ftt.trailer = on
+}
+
+// writetrailer writes trailer with size of package written before
+// to current position of given writer.
+func writetrailer(w io.WriteSeeker) (err error) {
+	var end int64
+	if end, err = w.Seek(0, io.SeekCurrent); err != nil {
+		return
+	}
+	var buf [TrailerSize]byte
+	util.SetU64(buf[:], uint64(end+TrailerSize))
+	copy(buf[8:], TrailerSign)
+	_, err = w.Write(buf[:])
+	return
+}
+
+// FindTrailer reads trailer at the end of host content with given size,
+// and returns offset and size of package appended to host content.
+// Package size includes the trailer.
+func FindTrailer(r io.ReaderAt, size int64) (offset, pkgsize int64, err error) {
+	var buf [TrailerSize]byte
+	if size < TrailerSize {
+		err = ErrNoTrailer
+		return
+	}
+	if _, err = r.ReadAt(buf[:], size-TrailerSize); err != nil {
+		return
+	}
+	if util.B2S(buf[8:]) != TrailerSign {
+		err = ErrNoTrailer
+		return
+	}
+	pkgsize = int64(util.GetU64(buf[:]))
+	if pkgsize < HeaderSize+TrailerSize || pkgsize > size {
+		err = ErrNoTrailer
+		return
+	}
+	offset = size - pkgsize
+	return
+}
+
+// hostTagger is tagger of package appended to host file,
+// that closes host file on close.
+type hostTagger struct {
+	Tagger
+	host io.Closer
+}
+
+// Close closes nested tagger and host file.
+// io.Closer implementation.
+func (ht *hostTagger) Close() error {
+	var err1 = ht.Tagger.Close()
+	var err2 = ht.host.Close()
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+// OpenAppended opens package appended to host file with given name and
+// ended by trailer. Tagger to access nested files is made by given function
+// with section of host file that contains the package. Host file is closed
+// when package tagger will be closed.
+func OpenAppended(fpath string, maketagger func(io.ReaderAt, int64) (Tagger, error)) (pkg *Package, err error) {
+	var f *os.File
+	if f, err = os.Open(fpath); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			pkg = nil
+		}
+	}()
+	var fi os.FileInfo
+	if fi, err = f.Stat(); err != nil {
+		return
+	}
+	var offset, size int64
+	if offset, size, err = FindTrailer(f, fi.Size()); err != nil {
+		return
+	}
+	var r = io.NewSectionReader(f, offset, size)
+
+	pkg = NewPackage()
+	if err = pkg.OpenReaderAt(r, size); err != nil {
+		return
+	}
+	var tgr Tagger
+	if tgr, err = maketagger(r, size); err != nil {
+		return
+	}
+	pkg.Tagger = &hostTagger{Tagger: tgr, host: f}
+	return
+}
+
+// OpenSelf opens package appended to running executable file.
+// Tagger to access nested files is made by given function,
+// for example by fsys.MakeTaggerAt.
+func OpenSelf(maketagger func(io.ReaderAt, int64) (Tagger, error)) (*Package, error) {
+	var fpath, err = os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return OpenAppended(fpath, maketagger)
+}
+
+// The End.
@@ -0,0 +1,128 @@
+package wpk_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+	"github.com/schwarzlichtbezirk/wpk/fsys"
+)
+
+// Test package appended to host file and found by trailer.
+func TestAppended(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+	var files = map[string]string{
+		"file1.txt":     "content of first file",
+		"dir/file2.txt": "content of second file",
+	}
+	var host = bytes.Repeat([]byte("host executable content\n"), 100)
+	if err = os.WriteFile(testpack1, host, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// append package to host file
+	var f *os.File
+	if f, err = os.OpenFile(testpack1, os.O_RDWR, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var w = io.NewOffsetWriter(f, int64(len(host)))
+	var pkg = wpk.NewPackage()
+	pkg.SetTrailer(true)
+	if err = pkg.Begin(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	for fkey, content := range files {
+		if _, err = pkg.PackData(w, bytes.NewReader([]byte(content)), fkey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = pkg.Sync(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	for name, maketagger := range map[string]func(io.ReaderAt, int64) (wpk.Tagger, error){
+		"bulk": bulk.MakeTaggerAt,
+		"fsys": fsys.MakeTaggerAt,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var pkg, err = wpk.OpenAppended(testpack1, maketagger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pkg.Close()
+			if pkg.TagsetNum() != len(files) {
+				t.Fatalf("expected %d files, got %d", len(files), pkg.TagsetNum())
+			}
+			for fkey, content := range files {
+				var data []byte
+				if data, err = pkg.ReadFile(fkey); err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != content {
+					t.Fatalf("wrong content of file '%s'", fkey)
+				}
+			}
+		})
+	}
+
+	// host content without package
+	if err = os.WriteFile(testpack1, host, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = wpk.OpenAppended(testpack1, fsys.MakeTaggerAt); !errors.Is(err, wpk.ErrNoTrailer) {
+		t.Fatalf("expected error on host file without package, got %v", err)
+	}
+	if _, err = wpk.OpenSelf(fsys.MakeTaggerAt); !errors.Is(err, wpk.ErrNoTrailer) {
+		t.Fatalf("expected error on test executable without package, got %v", err)
+	}
+}
+
+// Test that package with trailer is opened as standalone file.
+func TestTrailerStandalone(t *testing.T) {
+	var err error
+	defer os.Remove(testpack1)
+	var fwpk *os.File
+	if fwpk, err = os.OpenFile(testpack1, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var pkg = wpk.NewPackage()
+	pkg.SetTrailer(true)
+	pkg.SetIndex(true)
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pkg.PackData(fwpk, bytes.NewReader([]byte("content")), "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	fwpk.Close()
+
+	pkg = wpk.NewPackage()
+	if err = pkg.OpenFile(testpack1); err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	if b, err = os.ReadFile(testpack1); err != nil {
+		t.Fatal(err)
+	}
+	if err = pkg.OpenLazy(b); err != nil {
+		t.Fatal(err)
+	}
+	var offset, size int64
+	if offset, size, err = wpk.FindTrailer(bytes.NewReader(b), int64(len(b))); err != nil {
+		t.Fatal(err)
+	}
+	if offset != 0 || size != int64(len(b)) {
+		t.Fatalf("package is found at offset %d with size %d", offset, size)
+	}
+}
+
+// The End.
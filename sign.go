@@ -0,0 +1,119 @@
+package wpk
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+)
+
+// KeyIDSize is size of public key identifier stored at TIDkeyid tag.
+const KeyIDSize = 8
+
+// Errors on package signature verification.
+var (
+	ErrNoSign      = errors.New("package has no digital signature")
+	ErrSignKey     = errors.New("package is signed by untrusted key")
+	ErrSignFail    = errors.New("digital signature of files tags table does not pass")
+	ErrSignKeySize = errors.New("private key has wrong size")
+)
+
+// KeyID returns identifier of given public key, that is
+// first bytes of SHA-256 digest of the key.
+func KeyID(pub ed25519.PublicKey) []byte {
+	var h = sha256.Sum256(pub)
+	return h[:KeyIDSize]
+}
+
+// SetSigner sets Ed25519 private key to sign files tags table on each sync.
+// Key can be given as 32 bytes seed or 64 bytes private key.
+// Nil key turns off signing, and signature will be removed on next sync.
+func (ftt *FTT) SetSigner(key []byte) (err error) {
+	var priv ed25519.PrivateKey
+	switch len(key) {
+	case 0:
+	case ed25519.SeedSize:
+		priv = ed25519.NewKeyFromSeed(key)
+	case ed25519.PrivateKeySize:
+		priv = ed25519.PrivateKey(key)
+	default:
+		return ErrSignKeySize
+	}
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	ftt.signer = priv
+	return
+}
+
+// SetTrusted sets public keys to verify package signature on open stream.
+// Package without signature, or signed by other key, will not be opened.
+// No keys turns off verification.
+func (ftt *FTT) SetTrusted(keys ...ed25519.PublicKey) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	if len(keys) > 0 {
+		ftt.trusted = keys
+	} else {
+		ftt.trusted = nil
+	}
+}
+
+// signdata returns serialized files tags table with given package
+// info tagset, that is the message for signature.
+func (ftt *FTT) signdata(info TagsetRaw) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := ftt.writeto(&buf, info); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sign puts signature of files tags table into package info tagset,
+// or removes previous signature if there is no signer.
+// Mutex should be locked by caller.
+func (ftt *FTT) sign() (err error) {
+	var info = CopyTagset(ftt.info).Del(TIDsign).Del(TIDkeyid)
+	if ftt.signer == nil {
+		ftt.info = info
+		return
+	}
+	var pub = ftt.signer.Public().(ed25519.PublicKey)
+	info = info.Put(TIDkeyid, KeyID(pub))
+	var msg []byte
+	if msg, err = ftt.signdata(info); err != nil {
+		return
+	}
+	ftt.info = info.Put(TIDsign, ed25519.Sign(ftt.signer, msg))
+	return
+}
+
+// VerifySign checks up digital signature of files tags table by one of
+// given trusted public keys. Signature covers package info and all
+// files tagsets, including offsets, sizes and hash tags of files.
+func (ftt *FTT) VerifySign(keys ...ed25519.PublicKey) (err error) {
+	var sig, ok = ftt.info.Get(TIDsign)
+	if !ok {
+		return &ErrTag{ErrNoSign, "", TIDsign}
+	}
+	var keyid, _ = ftt.info.Get(TIDkeyid)
+	var pub ed25519.PublicKey
+	for _, key := range keys {
+		if bytes.Equal(KeyID(key), keyid) {
+			pub = key
+			break
+		}
+	}
+	if pub == nil {
+		return &ErrTag{ErrSignKey, "", TIDkeyid}
+	}
+	var msg []byte
+	if msg, err = ftt.signdata(CopyTagset(ftt.info).Del(TIDsign)); err != nil {
+		return
+	}
+	if !ed25519.Verify(pub, msg, sig) {
+		return &ErrTag{ErrSignFail, "", TIDsign}
+	}
+	return
+}
+
+// The End.
@@ -0,0 +1,109 @@
+package wpk_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+)
+
+// Test digital signature of files tags table, and package opening
+// with trusted keys.
+func TestSign(t *testing.T) {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	defer os.Remove(testpack)
+
+	var seed = bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	var priv = ed25519.NewKeyFromSeed(seed)
+	var pub = priv.Public().(ed25519.PublicKey)
+	var other, _, _ = ed25519.GenerateKey(nil) // public key of other pair
+
+	// open temporary file for read/write
+	if fwpk, err = os.OpenFile(testpack, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	// starts new package
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetInfo(wpk.TagsetRaw{}.Put(wpk.TIDlabel, wpk.StrTag("signed package")))
+	if err = pkg.SetSigner(seed); err != nil {
+		t.Fatal(err)
+	}
+	// put content
+	for name, data := range memdata {
+		if _, err = pkg.PackData(fwpk, bytes.NewReader(data), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// finalize
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// check up signature tags
+	if keyid, _ := pkg.GetInfo().Get(wpk.TIDkeyid); !bytes.Equal(keyid, wpk.KeyID(pub)) {
+		t.Fatal("package info has no valid key ID")
+	}
+	if label, _ := pkg.GetInfo().TagStr(wpk.TIDlabel); label != "signed package" {
+		t.Fatal("package label was lost on signing")
+	}
+
+	// open with trusted keys
+	var rpkg = wpk.NewPackage()
+	rpkg.SetTrusted(other, pub)
+	if err = rpkg.OpenStream(fwpk); err != nil {
+		t.Fatal(err)
+	}
+	if err = rpkg.VerifySign(other); !errors.Is(err, wpk.ErrSignKey) {
+		t.Fatalf("expected untrusted key error, got %v", err)
+	}
+
+	// modify file name at tags table
+	var fi, _ = fwpk.Stat()
+	var buf = make([]byte, fi.Size())
+	if _, err = fwpk.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	var pos = bytes.LastIndex(buf, []byte("sample.txt"))
+	if pos < 0 {
+		t.Fatal("file name is not found at tags table")
+	}
+	if _, err = fwpk.WriteAt([]byte("S"), int64(pos)); err != nil {
+		t.Fatal(err)
+	}
+	if err = rpkg.OpenStream(fwpk); !errors.Is(err, wpk.ErrSignFail) {
+		t.Fatalf("expected signature fail error, got %v", err)
+	}
+
+	// unsigned package should not be opened with trusted keys
+	if err = pkg.SetSigner(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = pkg.Append(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if pkg.GetInfo().Has(wpk.TIDsign) {
+		t.Fatal("signature was not removed")
+	}
+	if err = rpkg.OpenStream(fwpk); !errors.Is(err, wpk.ErrNoSign) {
+		t.Fatalf("expected no signature error, got %v", err)
+	}
+	rpkg.SetTrusted()
+	if err = rpkg.OpenStream(fwpk); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The End.
@@ -0,0 +1,142 @@
+package wpk
+
+import (
+	"bytes"
+	"io"
+)
+
+// solidBlock is solid block under construction, that accumulates
+// small files to be compressed together.
+type solidBlock struct {
+	blksize int      // maximum size of unpacked block, 0 turns off solid mode
+	maxsize int      // maximum size of file that can be put into block
+	id      uint     // identifier of last started block
+	offset  int64    // offset of block under construction in package data
+	buf     []byte   // unpacked content of block under construction
+	keys    []string // full keys of tagsets that refers to block under construction
+}
+
+// SetSolid turns on solid block mode for new packing files. Files with
+// size not more than 'maxsize' are grouped into blocks with unpacked size
+// up to 'blksize', and each block is compressed by DEFLATE as a whole.
+// Zero 'blksize' turns off solid mode.
+func (ftt *FTT) SetSolid(blksize, maxsize int) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	if maxsize > blksize {
+		maxsize = blksize
+	}
+	ftt.blk.blksize, ftt.blk.maxsize = blksize, maxsize
+}
+
+// lastblock returns maximum solid block identifier in the table.
+func (ftt *FTT) lastblock() (id uint) {
+	ftt.tsm.Range(func(fkey string, ts TagsetRaw) bool {
+		if v, ok := ts.TagUint(TIDblock); ok && v > id {
+			id = v
+		}
+		return true
+	})
+	return
+}
+
+// putblock puts small file content into solid block under construction.
+// Starts new block if there is no block yet, or it has no enough space.
+// Returns new tagset for the file. Mutex should be locked by caller.
+func (pkg *Package) putblock(w io.WriteSeeker, data []byte, fkey string) (ts TagsetRaw, err error) {
+	var blk = &pkg.blk
+	if len(blk.buf) > 0 && len(blk.buf)+len(data) > blk.blksize {
+		if err = pkg.flushblock(w); err != nil {
+			return
+		}
+	}
+	if len(blk.buf) == 0 {
+		if blk.offset, err = w.Seek(0, io.SeekCurrent); err != nil {
+			return
+		}
+		blk.id++
+	}
+	var blkoff = len(blk.buf)
+	blk.buf = append(blk.buf, data...)
+
+	// block size is unknown until it will be flushed
+	ts = pkg.BaseTagset(uint(blk.offset), 0, fkey).
+		Put(TIDcomp, ByteTag(CompDeflate)).
+		Put(TIDfsize, UintTag(uint(len(data)))).
+		Put(TIDblock, UintTag(blk.id)).
+		Put(TIDblkoff, UintTag(uint(blkoff)))
+	pkg.SetTagset(fkey, ts)
+	blk.keys = append(blk.keys, ts.Path())
+	return
+}
+
+// flushblock writes solid block under construction and updates
+// tagsets of all files that refers to it. Mutex should be locked by caller.
+func (ftt *FTT) flushblock(w io.Writer) (err error) {
+	var blk = &ftt.blk
+	if len(blk.buf) == 0 {
+		return
+	}
+	var cw = countWriter{w: w}
+	var dst io.Writer = &cw
+	var sw *SealWriter
+	if ftt.aead != nil {
+		if sw, err = NewSealWriter(&cw, ftt.aead); err != nil {
+			return
+		}
+		dst = sw
+	}
+	if _, _, err = CompressTo(dst, bytes.NewReader(blk.buf), CompDeflate); err != nil {
+		return
+	}
+	if sw != nil {
+		if err = sw.Close(); err != nil {
+			return
+		}
+	}
+	var size = cw.n
+	ftt.datsize += uint64(size)
+
+	for _, fkey := range blk.keys {
+		if ts, ok := ftt.tsm.Peek(fkey); ok {
+			if id, _ := ts.TagUint(TIDblock); id == blk.id {
+				ts = CopyTagset(ts).
+					Set(TIDoffset, UintTag(uint(blk.offset))).
+					Set(TIDsize, UintTag(uint(size)))
+				if sw != nil {
+					ts = ts.
+						Set(TIDcipher, ByteTag(CipherAESGCM)).
+						Set(TIDnonce, sw.Nonce())
+				}
+				ftt.tsm.Poke(fkey, ts)
+			}
+		}
+	}
+	blk.buf, blk.keys = blk.buf[:0], nil
+	return
+}
+
+// unflushed returns true if tagset refers to solid block
+// that was not written yet, and so has no size.
+func unflushed(ts TagsetRaw) bool {
+	if !ts.Has(TIDblock) {
+		return false
+	}
+	var size, _ = ts.TagUint(TIDsize)
+	return size == 0
+}
+
+// trackblock remembers tagset that refers to solid block under construction,
+// to update it when block will be written.
+func (ftt *FTT) trackblock(ts TagsetRaw) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	if len(ftt.blk.buf) == 0 {
+		return
+	}
+	if id, ok := ts.TagUint(TIDblock); ok && id == ftt.blk.id {
+		ftt.blk.keys = append(ftt.blk.keys, ts.Path())
+	}
+}
+
+// The End.
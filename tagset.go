@@ -318,7 +318,7 @@ func (ts TagsetRaw) SetOk(tid TID, tag TagRaw) (TagsetRaw, bool) {
 		copy(ts[tsi.tag:tsi.pos], tag)
 	} else {
 		util.SetU16(ts[tsi.tag-PTStagsz:tsi.tag], tl) // set tag length
-		var suff = ts[tsi.pos:]
+		var suff = append([]byte{}, ts[tsi.pos:]...)  // suffix can be overwritten by longer tag
 		ts = append(ts[:tsi.tag], tag...)
 		ts = append(ts, suff...)
 	}
@@ -458,8 +458,12 @@ func (ts TagsetRaw) Name() string {
 }
 
 // Size returns size of nested into package file.
+// For compressed file it returns original uncompressed size.
 // fs.FileInfo implementation.
 func (ts TagsetRaw) Size() int64 {
+	if fsize, ok := ts.TagUint(TIDfsize); ok {
+		return int64(fsize)
+	}
 	var size, _ = ts.TagUint(TIDsize)
 	return int64(size)
 }
@@ -490,10 +494,11 @@ func (ts TagsetRaw) Sys() interface{} {
 	return ts
 }
 
-// Type is for fs.DirEntry interface compatibility.
+// Type returns type bits of file mode.
+// fs.DirEntry interface implementation.
 func (ts TagsetRaw) Type() fs.FileMode {
 	if ts.Has(TIDsize) { // file size is absent for dir
-		return 0444
+		return 0
 	}
 	return fs.ModeDir
 }
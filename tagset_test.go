@@ -124,6 +124,18 @@ func TestTagset(t *testing.T) {
 	ts, ok = ts.DelOk(wpk.TIDmime)
 	assert(!ok, "'mime' tag can not be deleted again")
 	assert(ts.Num() == 4, "number of tags after repeated delete 'mime' must be unchanged")
+
+	// check up 'Set' with tag of other length
+	ts = ts.Set(wpk.TIDsize, wpk.UintTag(0xFFFFFFFFFF))
+	sv, ok = ts.TagUint(wpk.TIDsize)
+	assert(ok && sv == 0xFFFFFFFFFF, "'size' tag with greater length is not set correctly")
+	assert(ts.Path() == fkey, "'path' tag is broken after 'size' tag length increase")
+	fv, ok = ts.TagUint(wpk.TIDfid)
+	assert(ok && fv == fid, "'fid' tag is broken after 'size' tag length increase")
+	ts = ts.Set(wpk.TIDsize, wpk.UintTag(1))
+	sv, ok = ts.TagUint(wpk.TIDsize)
+	assert(ok && sv == 1, "'size' tag with less length is not set correctly")
+	assert(ts.Path() == fkey && ts.Num() == 4, "tagset is broken after 'size' tag length decrease")
 }
 
 func ExampleTagsetIterator_Next() {
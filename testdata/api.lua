@@ -92,6 +92,37 @@ to build wpk-packages.
 	autofid - get/set mode to put for each new file tag with unique file ID (FID).
 	automime - get/set mode to put for each new file tag with its MIME
 		determined by file extension, if it does not issued explicitly.
+	compress - get/set compression mode for each new file. Can be "none",
+		"deflate" to compress all files, or "auto" to compress by DEFLATE only
+		files with textual MIME type determined by file extension.
+	solid - get/set size of solid block in bytes. Files with size up to quarter
+		of block are grouped into solid blocks, compressed as a whole.
+		Zero value turns off solid mode.
+	cipherkey - setter sets the key to encrypt each new file by AES-GCM, key
+		should be 16, 24 or 32 bytes length, and can be given by 'hex2bin' call.
+		Empty string turns off encryption. Getter returns the key, or empty
+		string if encryption is turned off.
+	signkey - setter sets Ed25519 private key to sign files tags table on each
+		sync, key should be 32 bytes seed or 64 bytes private key, and can be
+		given by 'hex2bin' call. Empty string turns off signing. Getter returns
+		boolean value whether signing is turned on.
+	dedup - get/set mode to write identical content of new files once, file with
+		content already packed refers to existing data.
+	dedupnum - getter only, returns number of files deduplicated in dedup mode.
+	dedupsize - getter only, returns size of content that was not written
+		due to deduplication.
+	variant - get/set mode to put for each new file with compressible MIME type
+		its gzip variant with key suffix ".gz", if it's smaller than the file.
+		Variant refers to primary file by 'variant' tag, and has content-coding
+		at 'encoding' tag.
+	repro - get/set reproducible build mode. In this mode files tags table is
+		sorted by file keys on sync, and only modification time is stored for
+		new files, so the same files packed in the same order give identical
+		package. Encrypted files are not reproducible.
+	epoch - get/set UNIX time in seconds to clamp later modification times of
+		new files to it in reproducible build mode. Zero value means that time
+		is taken from SOURCE_DATE_EPOCH environment variable, or if it is not
+		set, all modification times are clamped to UNIX epoch start.
 	secret - get/set private key to sign hash MAC (MD5, SHA1, SHA224, etc).
 	crc32 - get/set mode to put for each new file tag with CRC32 of file.
 		Used Castagnoli's polynomial 0x82f63b78.
@@ -131,7 +162,8 @@ to build wpk-packages.
 	glob(pattern) - returns the names of all files in package matching pattern or nil
 		if there is no matching file.
 	hasfile(fkey) - check up file name existence in tags table.
-	filesize(fkey) - return record size of specified file name.
+	filesize(fkey) - return record size of specified file name. For compressed
+		file it returns original size.
 	putdata(fkey, data, tags) - write file with specified as string 'data' content,
 		and insert tagset with specified fkey to tags table. Data writes as is, and
 		can be in binary format. Key file name 'fkey' expected and should be unique
@@ -154,6 +186,10 @@ to build wpk-packages.
 	putalias(fkey1, fkey2) - clone tagset with file name 'fkey1' and replace
 		name tag in it to 'fkey2'. So, there will be two tagset referenced to
 		one data block. Keeps link to original file name.
+	linkvariant(fkey, enc) - mark already packed file with name 'fkey' and
+		suffix of content-coding 'enc' as pre-compressed variant of file 'fkey'.
+		Content-coding can be "gzip" for ".gz" suffix, "br" for ".br" suffix,
+		or "zstd" for ".zst" suffix. Returns false if any of both files is absent.
 	delalias(fkey) - delete tagset with specified file name. Data block is
 		still remains.
 	hastag(fkey, tid) - check up tag existence in tagset for specified file,
@@ -222,6 +258,21 @@ to build wpk-packages.
 	sha256  	23	hex string, 32 bytes
 	sha384  	24	hex string, 48 bytes
 	sha512  	25	hex string, 64 bytes
+	comp    	30	number
+	fsize   	31	number
+	block   	32	number
+	blkoff  	33	number
+	cipher  	34	number
+	nonce   	35	hex string, 12 bytes
+	sign    	36	hex string, 64 bytes
+	keyid   	37	hex string, 8 bytes
+	variant 	38	string
+	encoding	39	string
+	whiteout	40	boolean
+	dellist 	41	string
+	delta   	42	string
+	deltasum	43	hex string, 32 bytes
+	deltalen	44	number
 	tmbjpeg 	100	hex string
 	tmbwebp 	101	hex string
 	label   	110	string
@@ -18,6 +18,7 @@ type Void = struct{}
 type UnionDir struct {
 	TagsetRaw
 	*Union
+	pager dirpager
 }
 
 // fs.ReadDirFile interface implementation.
@@ -35,6 +36,8 @@ func (f *UnionDir) Close() error {
 	return nil
 }
 
+// ReadDir reads the directory entries sorted by name. Successive calls
+// returns next entries after the previous ones.
 // fs.ReadDirFile interface implementation.
 func (f *UnionDir) ReadDir(n int) ([]fs.DirEntry, error) {
 	var dir = f.Path()
@@ -43,12 +46,17 @@ func (f *UnionDir) ReadDir(n int) ([]fs.DirEntry, error) {
 			return nil, ErrOtherSubdir
 		}
 	}
-	return f.ReadDirN(dir, n)
+	return f.pager.next(n, func() ([]fs.DirEntry, error) {
+		return f.ReadDirN(dir, -1)
+	})
 }
 
 // Union glues list of packages into single filesystem.
 type Union struct {
 	List []*Package
+	// DelList turns on to honour lists of deleted files at packages info,
+	// files from those lists are hidden at lower packages.
+	DelList bool
 }
 
 // Close call Close-function for all included into the union packages.
@@ -62,27 +70,88 @@ func (u *Union) Close() (err error) {
 	return
 }
 
-// AllKeys returns list of all accessible files in union of packages.
-// If union have more than one file with the same name, only first
-// entry will be included to result.
-func (u *Union) AllKeys() (res []string) {
+// IsWhiteout returns true if given tagset is whiteout entry, that hides
+// files with the same name at lower packages of union.
+func IsWhiteout(ts TagsetRaw) bool {
+	var wh, _ = ts.TagBool(TIDwhiteout)
+	return wh
+}
+
+// PutWhiteout puts into package whiteout entry with given key, that hides
+// files with the same name at lower packages when package is placed
+// into union. Whiteout entry has no any data.
+func (pkg *Package) PutWhiteout(fkey string) TagsetRaw {
+	var ts = pkg.BaseTagset(uint(pkg.datoffset), 0, fkey).
+		Put(TIDwhiteout, BoolTag(true))
+	pkg.SetTagset(fkey, ts)
+	return ts
+}
+
+// Lookup returns package and tagset of the first file with given name
+// in union. Whiteout entry and list of deleted files, if it's honoured,
+// hide files at lower packages.
+func (u *Union) Lookup(fpath string) (*Package, TagsetRaw, bool) {
+	for _, pkg := range u.List {
+		if ts, is := pkg.GetTagset(fpath); is {
+			if IsWhiteout(ts) {
+				break
+			}
+			return pkg, ts, true
+		}
+		if u.DelList && pkg.IsDeleted(fpath) {
+			break
+		}
+	}
+	return nil, nil, false
+}
+
+// enum calls given closure for each accessible file in union of packages.
+// File at upper package hides files with the same name at lower packages,
+// whiteout entry hides them and is not enumerated itself. List of deleted
+// files, if it's honoured, hides files at lower packages.
+func (u *Union) enum(f func(*Package, string, TagsetRaw) bool) {
 	var found = map[string]Void{}
+	var next = true
 	for _, pkg := range u.List {
 		pkg.Enum(func(fkey string, ts TagsetRaw) bool {
-			if _, ok := found[fkey]; !ok {
-				res = append(res, fkey)
-				found[fkey] = Void{}
+			if _, ok := found[fkey]; ok {
+				return true
 			}
-			return true
+			found[fkey] = Void{}
+			if IsWhiteout(ts) {
+				return true
+			}
+			next = f(pkg, fkey, ts)
+			return next
 		})
+		if !next {
+			return
+		}
+		if u.DelList {
+			for _, fkey := range pkg.DelList() {
+				if fkey = pkg.TrimPath(fkey); fkey != "" {
+					found[fkey] = Void{}
+				}
+			}
+		}
 	}
+}
+
+// AllKeys returns list of all accessible files in union of packages.
+// If union have more than one file with the same name, only first
+// entry will be included to result.
+func (u *Union) AllKeys() (res []string) {
+	u.enum(func(pkg *Package, fkey string, ts TagsetRaw) bool {
+		res = append(res, fkey)
+		return true
+	})
 	return
 }
 
 // Sub clones object and gives access to pointed subdirectory.
 // fs.SubFS implementation.
 func (u *Union) Sub(dir string) (fs.FS, error) {
-	var u1 Union
+	var u1 = Union{DelList: u.DelList}
 	for _, pkg := range u.List {
 		if sub1, err1 := pkg.Sub(dir); err1 == nil {
 			u1.List = append(u1.List, sub1.(*Package))
@@ -98,11 +167,13 @@ func (u *Union) Sub(dir string) (fs.FS, error) {
 // If union have more than one file with the same name, info of the first will be returned.
 // fs.StatFS implementation.
 func (u *Union) Stat(fpath string) (fs.FileInfo, error) {
-	var ts TagsetRaw
-	var is bool
-	for _, pkg := range u.List {
-		if ts, is = pkg.GetTagset(fpath); is {
-			return ts, nil
+	if _, ts, is := u.Lookup(fpath); is {
+		return ts, nil
+	}
+	if f, err := u.Open(util.ToSlash(fpath)); err == nil {
+		defer f.Close()
+		if _, ok := f.(fs.ReadDirFile); ok {
+			return f.Stat()
 		}
 	}
 	return nil, &fs.PathError{Op: "stat", Path: fpath, Err: fs.ErrNotExist}
@@ -115,18 +186,12 @@ func (u *Union) Glob(pattern string) (res []string, err error) {
 	if _, err = path.Match(pattern, ""); err != nil {
 		return
 	}
-	var found = map[string]Void{}
-	for _, pkg := range u.List {
-		pkg.Enum(func(fkey string, ts TagsetRaw) bool {
-			if _, ok := found[fkey]; !ok {
-				if matched, _ := path.Match(pattern, fkey); matched {
-					res = append(res, fkey)
-				}
-				found[fkey] = Void{}
-			}
-			return true
-		})
-	}
+	u.enum(func(pkg *Package, fkey string, ts TagsetRaw) bool {
+		if matched, _ := path.Match(pattern, fkey); matched {
+			res = append(res, fkey)
+		}
+		return true
+	})
 	return
 }
 
@@ -134,73 +199,65 @@ func (u *Union) Glob(pattern string) (res []string, err error) {
 // If union have more than one file with the same name, first will be returned.
 // fs.ReadFileFS implementation.
 func (u *Union) ReadFile(fpath string) ([]byte, error) {
-	for _, pkg := range u.List {
-		if ts, is := pkg.GetTagset(fpath); is {
-			var f, err = pkg.Tagger.OpenTagset(ts)
-			if err != nil {
-				return nil, err
-			}
-			defer f.Close()
-
-			var size = ts.Size()
-			var buf = make([]byte, size)
-			_, err = f.Read(buf)
-			return buf, err
+	if !validpath(fpath) {
+		return nil, &fs.PathError{Op: "readfile", Path: fpath, Err: fs.ErrInvalid}
+	}
+	if pkg, ts, is := u.Lookup(fpath); is {
+		var f, err = pkg.Tagger.OpenTagset(ts)
+		if err != nil {
+			return nil, err
 		}
+		defer f.Close()
+
+		var size = ts.Size()
+		var buf = make([]byte, size)
+		_, err = io.ReadFull(f, buf)
+		return buf, err
 	}
 	return nil, &fs.PathError{Op: "readfile", Path: fpath, Err: fs.ErrNotExist}
 }
 
-// ReadDir reads the named directory
-// and returns a list of directory entries sorted by filename.
+// ReadDirN reads the named directory and returns a list of directory
+// entries sorted by filename. If n > 0, returns at most n first entries,
+// and io.EOF if there are no more entries.
 func (u *Union) ReadDirN(dir string, n int) (list []fs.DirEntry, err error) {
 	dir = util.ToSlash(dir)
-	var found = map[string]fs.DirEntry{}
-	var ni = n
-	for _, pkg := range u.List {
-		var fulldir = pkg.FullPath(dir)
-		var prefix string
-		if fulldir != "." {
-			prefix = fulldir + "/" // set terminated slash
-		}
+	var found = map[string]Void{}
+	var prefix string
+	if dir != "." && dir != "" {
+		prefix = dir + "/" // set terminated slash
+	}
 
-		pkg.tsm.Range(func(fkey string, ts TagsetRaw) bool {
-			if strings.HasPrefix(fkey, prefix) {
-				var suffix = fkey[len(prefix):]
-				var sp = strings.IndexByte(suffix, '/')
-				if sp < 0 { // file detected
-					found[suffix] = ts
-					ni--
-				} else { // dir detected
-					var subdir = util.JoinPath(prefix, suffix[:sp])
-					if _, ok := found[subdir]; !ok {
-						var dts = TagsetRaw{}.
-							Put(TIDpath, StrTag(subdir))
-						var f = &PackDirFile{
-							TagsetRaw: dts,
-							ftt:       pkg.FTT,
-						}
-						found[subdir] = f
-						ni--
+	u.enum(func(pkg *Package, fkey string, ts TagsetRaw) bool {
+		if strings.HasPrefix(fkey, prefix) {
+			var suffix = fkey[len(prefix):]
+			var sp = strings.IndexByte(suffix, '/')
+			if sp < 0 { // file detected
+				list = append(list, ts)
+			} else { // dir detected
+				if _, ok := found[suffix[:sp]]; !ok {
+					var subdir = util.JoinPath(pkg.FullPath(dir), suffix[:sp])
+					var dts = TagsetRaw{}.
+						Put(TIDpath, StrTag(subdir))
+					var f = &UnionDir{
+						TagsetRaw: dts,
+						Union:     u,
 					}
+					found[suffix[:sp]] = Void{}
+					list = append(list, f)
 				}
 			}
-			return ni != 0
-		})
-
-		if ni == 0 {
-			break
 		}
-	}
+		return true
+	})
 
-	list = make([]fs.DirEntry, len(found))
-	var i int
-	for _, de := range found {
-		list[i] = de
-		i++
-	}
-	if ni > 0 {
-		err = io.EOF
+	sortdir(list)
+	if n > 0 {
+		if len(list) > n {
+			list = list[:n]
+		} else if len(list) < n {
+			err = io.EOF
+		}
 	}
 	return
 }
@@ -216,7 +273,9 @@ func (u *Union) ReadDir(dir string) ([]fs.DirEntry, error) {
 // If union have more than one file with the same name, first will be returned.
 // fs.FS implementation.
 func (u *Union) Open(dir string) (fs.File, error) {
-	dir = util.ToSlash(dir)
+	if !validpath(dir) {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrInvalid}
+	}
 	if len(u.List) == 0 {
 		return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
 	}
@@ -235,10 +294,8 @@ func (u *Union) Open(dir string) (fs.File, error) {
 	}
 
 	// try to get the file
-	for _, pkg := range u.List {
-		if ts, is := pkg.GetTagset(dir); is {
-			return pkg.Tagger.OpenTagset(ts)
-		}
+	if pkg, ts, is := u.Lookup(dir); is {
+		return pkg.Tagger.OpenTagset(ts)
 	}
 
 	// try to get the folder
@@ -246,23 +303,21 @@ func (u *Union) Open(dir string) (fs.File, error) {
 	if dir != "." && dir != "" {
 		prefix = dir + "/" // set terminated slash
 	}
-	for _, pkg := range u.List {
-		var f *UnionDir
-		pkg.Enum(func(fkey string, ts TagsetRaw) bool {
-			if strings.HasPrefix(fkey, prefix) {
-				var dts = TagsetRaw{}.
-					Put(TIDpath, StrTag(pkg.FullPath(dir)))
-				f = &UnionDir{
-					TagsetRaw: dts,
-					Union:     u,
-				}
-				return false
+	var f *UnionDir
+	u.enum(func(pkg *Package, fkey string, ts TagsetRaw) bool {
+		if strings.HasPrefix(fkey, prefix) {
+			var dts = TagsetRaw{}.
+				Put(TIDpath, StrTag(pkg.FullPath(dir)))
+			f = &UnionDir{
+				TagsetRaw: dts,
+				Union:     u,
 			}
-			return true
-		})
-		if f != nil {
-			return f, nil
+			return false
 		}
+		return true
+	})
+	if f != nil {
+		return f, nil
 	}
 	// on case if not found
 	return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
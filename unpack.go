@@ -0,0 +1,126 @@
+package wpk
+
+import (
+	"crypto/cipher"
+	"io"
+	"sync"
+)
+
+// Number of unpacked solid blocks kept by Unpacker.
+const blockcachesize = 8
+
+// Unpacker gives access to content of nested files by their raw data:
+// decrypts the data if cipher key was given, decompresses it,
+// and keeps recently unpacked solid blocks, so files from the same
+// block does not unpack it again. Zero value is ready to use
+// for packages without encryption.
+type Unpacker struct {
+	aead   cipher.AEAD     // cipher to decrypt files, can be nil
+	blocks map[uint][]byte // keys - blocks offsets, values - unpacked content
+	order  []uint          // blocks offsets in order they were placed
+	mux    sync.Mutex
+}
+
+// SetKey sets the key to decrypt files encrypted by AES-GCM.
+func (u *Unpacker) SetKey(key []byte) (err error) {
+	var aead cipher.AEAD
+	if aead, err = NewAEAD(key); err != nil {
+		return
+	}
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	u.aead = aead
+	return
+}
+
+func (u *Unpacker) get(offset uint) (b []byte, ok bool) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	b, ok = u.blocks[offset]
+	return
+}
+
+func (u *Unpacker) put(offset uint, b []byte) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	if u.blocks == nil {
+		u.blocks = map[uint][]byte{}
+	}
+	if _, ok := u.blocks[offset]; ok {
+		return
+	}
+	if len(u.order) >= blockcachesize {
+		delete(u.blocks, u.order[0])
+		u.order = u.order[1:]
+	}
+	u.blocks[offset] = b
+	u.order = append(u.order, offset)
+}
+
+// decrypt returns file with decrypted content if tagset points
+// to encrypted data, or returns given file as is otherwise.
+func (u *Unpacker) decrypt(f RFile, ts TagsetRaw) (RFile, error) {
+	if alg, ok := ts.TagByte(TIDcipher); !ok || alg == CipherNone {
+		return f, nil
+	}
+	var cf, err = NewCipherFile(f, u.aead, ts)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return cf, nil
+}
+
+// Open returns file with unpacked content for given tagset. Raw package data
+// pointed by tagset is opened by given function. If tagset refers to solid
+// block, block is unpacked once and shared by all files placed in it.
+// Binary deltas are refused with ErrDeltaBase, they can be opened only
+// by DeltaTagger that has access to base files.
+func (u *Unpacker) Open(ts TagsetRaw, open func() (RFile, error)) (RFile, error) {
+	if ts.Has(TIDdelta) {
+		return nil, &ErrTag{ErrDeltaBase, ts.Path(), TIDdelta}
+	}
+	if !ts.Has(TIDblock) {
+		var f, err = open()
+		if err != nil {
+			return nil, err
+		}
+		if f, err = u.decrypt(f, ts); err != nil {
+			return nil, err
+		}
+		return UnpackFile(f, ts)
+	}
+
+	var offset, _ = ts.Pos()
+	var blkoff, _ = ts.TagUint(TIDblkoff)
+	var fsize = uint(ts.Size())
+	var b, ok = u.get(offset)
+	if !ok {
+		var method, _ = ts.TagByte(TIDcomp)
+		var f, err = open()
+		if err != nil {
+			return nil, err
+		}
+		if f, err = u.decrypt(f, ts); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var dc io.ReadCloser
+		if dc, err = Decompressor(f, method); err != nil {
+			return nil, &ErrTag{err, ts.Path(), TIDcomp}
+		}
+		defer dc.Close()
+
+		if b, err = io.ReadAll(dc); err != nil {
+			return nil, err
+		}
+		u.put(offset, b)
+	}
+	if blkoff+fsize > uint(len(b)) {
+		return nil, &ErrTag{ErrOutSize, ts.Path(), TIDblkoff}
+	}
+	return NewMemFile(b[blkoff:blkoff+fsize], ts), nil
+}
+
+// The End.
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"sort"
 	"sync"
 )
 
@@ -120,3 +121,16 @@ func (m *SeqMap[K, T]) Range(f func(K, T) bool) {
 		}
 	}
 }
+
+// Sort reorders the sequence by given keys comparison function.
+func (m *SeqMap[K, T]) Sort(less func(K, K) bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	sort.SliceStable(m.seq, func(i, j int) bool {
+		return less(m.seq[i].key, m.seq[j].key)
+	})
+	for i, pair := range m.seq {
+		m.idx[pair.key] = i
+	}
+}
@@ -0,0 +1,160 @@
+package wpk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// VariantSuffix is map of content-coding names of pre-compressed variants
+// to suffixes of variants keys.
+var VariantSuffix = map[string]string{
+	"gzip": ".gz",
+	"br":   ".br",
+	"zstd": ".zst",
+}
+
+// ErrVariantEnc is error on content-coding of variant that does not supported.
+var ErrVariantEnc = errors.New("content-coding of variant does not supported")
+
+// VariantKey returns key of variant of file with given key and content-coding,
+// or empty string if content-coding does not supported.
+func VariantKey(fkey, enc string) string {
+	if suffix, ok := VariantSuffix[enc]; ok {
+		return fkey + suffix
+	}
+	return ""
+}
+
+// EncodeGzip returns data compressed by gzip with best compression level.
+func EncodeGzip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw, err = gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// variantTagset returns tagset of file with given key and tags
+// of variant of primary file with given full key and content-coding.
+// Modification time and MIME type of primary file are copied to variant.
+func variantTagset(ts, pts TagsetRaw, enc string) TagsetRaw {
+	ts = CopyTagset(ts).
+		Set(TIDvariant, StrTag(pts.Path())).
+		Set(TIDencoding, StrTag(enc))
+	if tag, ok := pts.Get(TIDmtime); ok {
+		ts = ts.Set(TIDmtime, tag)
+	}
+	if tag, ok := pts.Get(TIDmime); ok {
+		ts = ts.Set(TIDmime, tag)
+	}
+	return ts
+}
+
+// PackVariant puts content encoded by given content-coding streamed by given
+// reader into package as variant of file with given key. Variant is placed
+// with key given by VariantKey. Primary file should be packed before.
+func (pkg *Package) PackVariant(w io.WriteSeeker, r io.Reader, fkey, enc string) (ts TagsetRaw, err error) {
+	var vkey = VariantKey(fkey, enc)
+	if vkey == "" {
+		err = &fs.PathError{Op: "packvariant", Path: fkey, Err: ErrVariantEnc}
+		return
+	}
+	var pts, ok = pkg.PeekTagset(fkey)
+	if !ok {
+		err = &fs.PathError{Op: "packvariant", Path: fkey, Err: fs.ErrNotExist}
+		return
+	}
+	if ts, err = pkg.PackData(w, r, vkey); err != nil {
+		return
+	}
+	ts = variantTagset(ts, pts, enc)
+	pkg.SetTagset(vkey, ts)
+	return
+}
+
+// PackGzipVariant puts gzip variant of file with given key and content.
+// Returns nil tagset if compressed content is not smaller than original,
+// in this case variant is not packed.
+func (pkg *Package) PackGzipVariant(w io.WriteSeeker, data []byte, fkey string) (ts TagsetRaw, err error) {
+	var buf []byte
+	if buf, err = EncodeGzip(data); err != nil {
+		return
+	}
+	if len(buf) >= len(data) {
+		return
+	}
+	return pkg.PackVariant(w, bytes.NewReader(buf), fkey, "gzip")
+}
+
+// LinkVariant marks already packed file with key given by VariantKey
+// as variant of file with given key and content-coding.
+// Returns false if any of both files is absent.
+func (pkg *Package) LinkVariant(fkey, enc string) bool {
+	var vkey = VariantKey(fkey, enc)
+	if vkey == "" {
+		return false
+	}
+	var pts, ok1 = pkg.PeekTagset(fkey)
+	var ts, ok2 = pkg.PeekTagset(vkey)
+	if !ok1 || !ok2 {
+		return false
+	}
+	pkg.SetTagset(vkey, variantTagset(ts, pts, enc))
+	return true
+}
+
+// GetVariant returns tagset of the first variant of file with given key
+// from given list of acceptable content-codings in order of preference,
+// and content-coding of found variant. Returns tagset of file itself with
+// empty content-coding if there is no acceptable variant, or "identity"
+// is met in the list first. Returns false if file is absent.
+func (pkg *Package) GetVariant(fkey string, accept []string) (ts TagsetRaw, enc string, ok bool) {
+	if ts, ok = pkg.GetTagset(fkey); !ok {
+		return
+	}
+	var fpath = ts.Path()
+	for _, e := range accept {
+		if e == "identity" {
+			break
+		}
+		var vkey = VariantKey(fkey, e)
+		if vkey == "" {
+			continue
+		}
+		if vts, is := pkg.GetTagset(vkey); is {
+			var link, _ = vts.TagStr(TIDvariant)
+			var venc, _ = vts.TagStr(TIDencoding)
+			if link == fpath && venc == e {
+				return vts, e, true
+			}
+		}
+	}
+	return
+}
+
+// OpenVariant opens the first variant of file with given key from given
+// list of acceptable content-codings in order of preference, and returns
+// content-coding of opened variant. Opens file itself with empty
+// content-coding if there is no acceptable variant.
+func (pkg *Package) OpenVariant(fkey string, accept []string) (f RFile, enc string, err error) {
+	var ts TagsetRaw
+	var ok bool
+	if ts, enc, ok = pkg.GetVariant(fkey, accept); !ok {
+		err = &fs.PathError{Op: "openvariant", Path: fkey, Err: fs.ErrNotExist}
+		return
+	}
+	f, err = pkg.Tagger.OpenTagset(ts)
+	return
+}
+
+// The End.
@@ -0,0 +1,116 @@
+package wpk_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+)
+
+// Test packing of pre-compressed variants and selection of variant
+// by list of acceptable content-codings.
+func TestVariant(t *testing.T) {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	defer os.Remove(testpack)
+
+	var text = []byte(strings.Repeat("some compressible text content\n", 64))
+	var brdata = []byte("brotli content is packed as is")
+
+	// open temporary file for read/write
+	if fwpk, err = os.OpenFile(testpack, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	// starts new package
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	var ts wpk.TagsetRaw
+	if ts, err = pkg.PackData(fwpk, bytes.NewReader(text), "app.js"); err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetTagset("app.js", ts.Put(wpk.TIDmime, wpk.StrTag("text/javascript")))
+	if ts, err = pkg.PackGzipVariant(fwpk, text, "app.js"); err != nil {
+		t.Fatal(err)
+	}
+	if ts == nil {
+		t.Fatal("gzip variant is not packed for compressible content")
+	}
+	if ctype, _ := ts.TagStr(wpk.TIDmime); ctype != "text/javascript" {
+		t.Fatal("MIME type of primary file is not copied to variant")
+	}
+	if _, err = pkg.PackVariant(fwpk, bytes.NewReader(brdata), "app.js", "br"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pkg.PackVariant(fwpk, bytes.NewReader(brdata), "absent.js", "br"); err == nil {
+		t.Fatal("variant of absent file should not be packed")
+	}
+	// file with variant suffix that is not linked to primary
+	if _, err = pkg.PackData(fwpk, bytes.NewReader(text), "data.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pkg.PackData(fwpk, bytes.NewReader(brdata), "data.txt.gz"); err != nil {
+		t.Fatal(err)
+	}
+	// finalize
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if pkg.Tagger, err = bulk.MakeTagger(testpack); err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.Close()
+
+	var check = func(fkey string, accept []string, expect string) {
+		var _, enc, ok = pkg.GetVariant(fkey, accept)
+		if !ok {
+			t.Fatalf("file '%s' is not found", fkey)
+		}
+		if enc != expect {
+			t.Fatalf("for '%s' with %v expected '%s' content-coding, got '%s'", fkey, accept, expect, enc)
+		}
+	}
+	check("app.js", []string{"br", "gzip"}, "br")
+	check("app.js", []string{"gzip", "br"}, "gzip")
+	check("app.js", []string{"zstd", "gzip"}, "gzip")
+	check("app.js", []string{"identity", "gzip"}, "")
+	check("app.js", nil, "")
+	check("data.txt", []string{"gzip"}, "")
+
+	// read gzip variant content
+	var f wpk.RFile
+	var enc string
+	if f, enc, err = pkg.OpenVariant("app.js", []string{"gzip"}); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if enc != "gzip" {
+		t.Fatalf("expected gzip variant, got '%s'", enc)
+	}
+	var zr *gzip.Reader
+	if zr, err = gzip.NewReader(f); err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	if b, err = io.ReadAll(zr); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, text) {
+		t.Fatal("content of gzip variant is not equal to original")
+	}
+	if _, _, err = pkg.OpenVariant("absent.js", []string{"gzip"}); err == nil {
+		t.Fatal("absent file should not be opened")
+	}
+}
+
+// The End.
@@ -0,0 +1,267 @@
+package wpk
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ErrHashFail is error on file content that does not match to hash tag.
+var ErrHashFail = errors.New("file content does not match to hash tag")
+
+// HashTIDs is list of tags IDs with hash of file content.
+var HashTIDs = []TID{
+	TIDcrc32ieee, TIDcrc32c, TIDcrc32k, TIDcrc64iso,
+	TIDmd5, TIDsha1, TIDsha224, TIDsha256, TIDsha384, TIDsha512,
+}
+
+// IsDigestTID returns true for tags IDs with cryptographic digest
+// of file content, they are MD5 and SHA digests. Unlike CRC checksums,
+// equal digests give evidence of equal content.
+func IsDigestTID(tid TID) bool {
+	return tid >= TIDmd5 && tid <= TIDsha512
+}
+
+// NewTagHash returns hash to compute content of tag with given ID.
+// MD5 and SHA digests are computed as HMAC with given secret.
+// Returns nil if tag ID is not hash.
+func NewTagHash(tid TID, secret []byte) hash.Hash {
+	switch tid {
+	case TIDcrc32ieee:
+		return crc32.NewIEEE()
+	case TIDcrc32c:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case TIDcrc32k:
+		return crc32.New(crc32.MakeTable(crc32.Koopman))
+	case TIDcrc64iso:
+		return crc64.New(crc64.MakeTable(crc64.ISO))
+	case TIDmd5:
+		return hmac.New(md5.New, secret)
+	case TIDsha1:
+		return hmac.New(sha1.New, secret)
+	case TIDsha224:
+		return hmac.New(sha256.New224, secret)
+	case TIDsha256:
+		return hmac.New(sha256.New, secret)
+	case TIDsha384:
+		return hmac.New(sha512.New384, secret)
+	case TIDsha512:
+		return hmac.New(sha512.New, secret)
+	}
+	return nil
+}
+
+// tagHash is hash of file content with tag ID, where expected digest is.
+type tagHash struct {
+	tid TID
+	hash.Hash
+}
+
+// makehashes returns list of hashes for all hash tags present in tagset.
+func makehashes(ts TagsetRaw, secret []byte) (list []tagHash) {
+	for _, tid := range HashTIDs {
+		if ts.Has(tid) {
+			list = append(list, tagHash{tid, NewTagHash(tid, secret)})
+		}
+	}
+	return
+}
+
+// checkhashes compares computed digests with hash tags of tagset.
+func checkhashes(ts TagsetRaw, list []tagHash) error {
+	for _, th := range list {
+		var tag, _ = ts.Get(th.tid)
+		if !bytes.Equal(tag, th.Sum(nil)) {
+			return &ErrTag{ErrHashFail, ts.Path(), th.tid}
+		}
+	}
+	return nil
+}
+
+// VerifyFile computes hashes of file content on sequential reading, and
+// compares them with hash tags when the end of file is reached.
+// RFile interface implementation.
+type VerifyFile struct {
+	RFile
+	tags   TagsetRaw
+	hashes []tagHash
+	pos    int64 // position of sequential reading
+	seq    bool  // file is read sequentially from the start
+	err    error // result of verification
+	done   bool  // verification is complete
+}
+
+// NewVerifyFile wraps given file to verify its content by hash tags of tagset.
+func NewVerifyFile(f RFile, ts TagsetRaw, secret []byte) *VerifyFile {
+	return &VerifyFile{
+		RFile:  f,
+		tags:   ts,
+		hashes: makehashes(ts, secret),
+		seq:    true,
+	}
+}
+
+// Read is io.Reader implementation. Returns error of ErrTag type
+// if content of file does not match to hash tag at the end of file,
+// in this case the last read portion of data is not returned.
+func (f *VerifyFile) Read(b []byte) (n int, err error) {
+	n, err = f.RFile.Read(b)
+	if f.seq && !f.done {
+		for _, th := range f.hashes {
+			th.Write(b[:n])
+		}
+		f.pos += int64(n)
+		if f.pos >= f.tags.Size() || err == io.EOF {
+			f.err, f.done = checkhashes(f.tags, f.hashes), true
+			if f.err != nil {
+				n = 0
+			}
+		}
+	}
+	if f.err != nil && (err == nil || err == io.EOF) {
+		err = f.err
+	}
+	return
+}
+
+// Seek is io.Seeker implementation. Verification continues only
+// if file is read from the start without gaps.
+func (f *VerifyFile) Seek(offset int64, whence int) (abs int64, err error) {
+	if abs, err = f.RFile.Seek(offset, whence); err != nil {
+		return
+	}
+	if abs == 0 && !f.done {
+		for _, th := range f.hashes {
+			th.Reset()
+		}
+		f.pos, f.seq = 0, true
+	} else if abs != f.pos {
+		f.seq = false
+	}
+	return
+}
+
+// Verified returns true if verification is complete, and result of it.
+func (f *VerifyFile) Verified() (bool, error) {
+	return f.done, f.err
+}
+
+// VerifyTagger is decorator for Tagger, that gives files verified
+// by hash tags on reading.
+// Tagger interface implementation.
+type VerifyTagger struct {
+	Tagger
+	secret []byte // HMAC key for MD5 and SHA digests
+}
+
+// NewVerifyTagger returns decorator for given tagger, with secret
+// used to compute HMAC for MD5 and SHA digests.
+func NewVerifyTagger(tgr Tagger, secret []byte) *VerifyTagger {
+	return &VerifyTagger{
+		Tagger: tgr,
+		secret: secret,
+	}
+}
+
+// OpenTagset returns file that checks up its content by hash tags
+// when it read to the end. Files without hash tags returned as is.
+func (vt *VerifyTagger) OpenTagset(ts TagsetRaw) (RFile, error) {
+	var f, err = vt.Tagger.OpenTagset(ts)
+	if err != nil {
+		return nil, err
+	}
+	for _, tid := range HashTIDs {
+		if ts.Has(tid) {
+			return NewVerifyFile(f, ts, vt.secret), nil
+		}
+	}
+	return f, nil
+}
+
+// VerifyResult is result of verification of one file.
+type VerifyResult struct {
+	Key     string // file key
+	Checked int    // number of hash tags that were checked up
+	Err     error  // nil if file passes verification
+}
+
+// Verify reads each file of package concurrently, and checks up its
+// content by all present hash tags. MD5 and SHA digests are checked
+// as HMAC with given secret. Returns results for each file in order
+// of files tags table, or context error if it was canceled.
+func (pkg *Package) Verify(ctx context.Context, secret []byte) (res []VerifyResult, err error) {
+	var keys []string
+	var tslist []TagsetRaw
+	pkg.Enum(func(fkey string, ts TagsetRaw) bool {
+		keys = append(keys, fkey)
+		tslist = append(tslist, ts)
+		return true
+	})
+	res = make([]VerifyResult, len(keys))
+
+	var wg sync.WaitGroup
+	var idxch = make(chan int)
+	for n := runtime.GOMAXPROCS(0); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxch {
+				res[i] = pkg.verifyfile(keys[i], tslist[i], secret)
+			}
+		}()
+	}
+loop:
+	for i := range keys {
+		select {
+		case idxch <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(idxch)
+	wg.Wait()
+	err = ctx.Err()
+	return
+}
+
+// verifyfile reads file with given tagset and checks up its content.
+func (pkg *Package) verifyfile(fkey string, ts TagsetRaw, secret []byte) (vr VerifyResult) {
+	vr.Key = fkey
+	var hashes = makehashes(ts, secret)
+	vr.Checked = len(hashes)
+	var f, err = pkg.Tagger.OpenTagset(ts)
+	if err != nil {
+		vr.Err = err
+		return
+	}
+	defer f.Close()
+
+	var w = make([]io.Writer, len(hashes))
+	for i, th := range hashes {
+		w[i] = th
+	}
+	var n int64
+	if n, err = io.Copy(io.MultiWriter(w...), f); err != nil {
+		vr.Err = err
+		return
+	}
+	if n != ts.Size() {
+		vr.Err = &ErrTag{ErrOutSize, ts.Path(), TIDsize}
+		return
+	}
+	vr.Err = checkhashes(ts, hashes)
+	return
+}
+
+// The End.
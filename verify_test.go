@@ -0,0 +1,209 @@
+package wpk_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+)
+
+// Test files verification by hash tags on reading, and verification
+// of whole package.
+func TestVerify(t *testing.T) {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+	var secret = []byte("secret")
+
+	defer os.Remove(testpack)
+
+	// open temporary file for read/write
+	if fwpk, err = os.OpenFile(testpack, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+
+	// starts new package
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	// put content with hash tags
+	for name, data := range memdata {
+		var ts wpk.TagsetRaw
+		if ts, err = pkg.PackData(fwpk, bytes.NewReader(data), name); err != nil {
+			t.Fatal(err)
+		}
+		for _, tid := range []wpk.TID{wpk.TIDcrc32c, wpk.TIDsha256} {
+			var h = wpk.NewTagHash(tid, secret)
+			h.Write(data)
+			ts = ts.Put(tid, h.Sum(nil))
+		}
+		pkg.SetTagset(name, ts)
+	}
+	if _, err = pkg.PackData(fwpk, bytes.NewReader(compdata["text/lorem.txt"]), "lorem.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// finalize
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var check = func(secret []byte) (map[string]error, error) {
+		var pkg = wpk.NewPackage()
+		if err = pkg.OpenFile(testpack); err != nil {
+			t.Fatal(err)
+		}
+		var tgr wpk.Tagger
+		if tgr, err = bulk.MakeTagger(testpack); err != nil {
+			t.Fatal(err)
+		}
+		pkg.Tagger = wpk.NewVerifyTagger(tgr, secret)
+		defer pkg.Close()
+
+		var res []wpk.VerifyResult
+		if res, err = pkg.Verify(context.Background(), secret); err != nil {
+			return nil, err
+		}
+		var errs = map[string]error{}
+		for _, vr := range res {
+			errs[vr.Key] = vr.Err
+		}
+		if len(errs) != 3 {
+			t.Fatalf("expected 3 verification results, got %d", len(errs))
+		}
+		// read files by verifying tagger
+		for name := range memdata {
+			var _, err = pkg.ReadFile(name)
+			if (err == nil) != (errs[name] == nil) {
+				t.Fatalf("reading of '%s' gives %v, but verification gives %v", name, err, errs[name])
+			}
+			var f fs.File
+			if f, err = pkg.Open(name); err != nil {
+				t.Fatal(err)
+			}
+			_, err = io.ReadAll(f)
+			f.Close()
+			if (err == nil) != (errs[name] == nil) {
+				t.Fatalf("streaming of '%s' gives %v, but verification gives %v", name, err, errs[name])
+			}
+		}
+		return errs, nil
+	}
+
+	var errs map[string]error
+	if errs, err = check(secret); err != nil {
+		t.Fatal(err)
+	}
+	for name, err := range errs {
+		if err != nil {
+			t.Fatalf("file '%s' does not pass verification: %v", name, err)
+		}
+	}
+
+	// wrong secret fails HMAC
+	if errs, err = check([]byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	var et *wpk.ErrTag
+	if !errors.As(errs["sample.txt"], &et) || et.TID != wpk.TIDsha256 {
+		t.Fatalf("expected SHA256 mismatch error, got %v", errs["sample.txt"])
+	}
+
+	// corrupt file content
+	var ts, _ = pkg.GetTagset("sample.txt")
+	var offset, _ = ts.Pos()
+	if _, err = fwpk.WriteAt([]byte("Q"), int64(offset)+4); err != nil {
+		t.Fatal(err)
+	}
+	if errs, err = check(secret); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.As(errs["sample.txt"], &et) || !errors.Is(et, wpk.ErrHashFail) || et.TID != wpk.TIDcrc32c {
+		t.Fatalf("expected CRC32C mismatch error, got %v", errs["sample.txt"])
+	}
+	if errs["array.dat"] != nil || errs["lorem.txt"] != nil {
+		t.Fatal("unchanged files should pass verification")
+	}
+
+	// canceled verification
+	if pkg.Tagger, err = bulk.MakeTagger(testpack); err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.Close()
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err = pkg.Verify(ctx, secret); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+}
+
+// Test that package with bad tagsets is opened in tolerant mode
+// with remaining files, and each bad tagset is reported.
+func TestTolerant(t *testing.T) {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	defer os.Remove(testpack)
+
+	if fwpk, err = os.OpenFile(testpack, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range memdata {
+		if _, err = pkg.PackData(fwpk, bytes.NewReader(data), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkg.SetTagset("badoff.txt", pkg.BaseTagset(1<<30, 10, "badoff.txt"))
+	pkg.SetTagset("badsize.txt", pkg.BaseTagset(wpk.HeaderSize, 1<<30, "badsize.txt"))
+	pkg.SetTagset("badfsize.txt", pkg.BaseTagset(wpk.HeaderSize, 10, "badfsize.txt").
+		Put(wpk.TIDfsize, wpk.UintTag(20)))
+	pkg.SetTagset("badcipher.txt", pkg.BaseTagset(wpk.HeaderSize, 10, "badcipher.txt").
+		Put(wpk.TIDcipher, wpk.ByteTag(wpk.CipherAESGCM)).
+		Put(wpk.TIDfsize, wpk.UintTag(1<<62)))
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// strict mode fails on first bad tagset
+	if err = wpk.NewPackage().OpenFile(testpack); !errors.Is(err, wpk.ErrOutOff) && !errors.Is(err, wpk.ErrOutSize) {
+		t.Fatalf("expected error on bad tagset, got %v", err)
+	}
+
+	var bad = map[string]error{}
+	var pkg1 = wpk.NewPackage()
+	pkg1.SetTolerant(func(err error) {
+		var et *wpk.ErrTag
+		if !errors.As(err, &et) {
+			t.Fatalf("expected tag error, got %v", err)
+		}
+		bad[et.Key] = err
+	})
+	if err = pkg1.OpenFile(testpack); err != nil {
+		t.Fatal(err)
+	}
+	if pkg1.TagsetNum() != len(memdata) {
+		t.Fatalf("expected %d files, got %d", len(memdata), pkg1.TagsetNum())
+	}
+	if len(bad) != 4 || !errors.Is(bad["badoff.txt"], wpk.ErrOutOff) || !errors.Is(bad["badsize.txt"], wpk.ErrOutSize) {
+		t.Fatalf("bad tagsets are not reported properly: %v", bad)
+	}
+	for _, fkey := range []string{"badfsize.txt", "badcipher.txt"} {
+		var et *wpk.ErrTag
+		if !errors.As(bad[fkey], &et) || et.What != wpk.ErrOutSize || et.TID != wpk.TIDfsize {
+			t.Fatalf("expected error on file size of '%s', got %v", fkey, bad[fkey])
+		}
+	}
+}
+
+// The End.
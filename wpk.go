@@ -1,14 +1,18 @@
 package wpk
 
 import (
+	"crypto/cipher"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
 	"os"
 	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/schwarzlichtbezirk/wpk/util"
 )
@@ -50,6 +54,23 @@ const (
 	TIDsha384 TID = 24 // [48]byte
 	TIDsha512 TID = 25 // [64]byte
 
+	TIDcomp   TID = 30 // byte, compression method
+	TIDfsize  TID = 31 // uint, original size of compressed file
+	TIDblock  TID = 32 // uint, solid block ID
+	TIDblkoff TID = 33 // uint, file offset in unpacked solid block
+	TIDcipher TID = 34 // byte, cipher algorithm
+	TIDnonce  TID = 35 // []byte, nonce of encrypted file
+	TIDsign   TID = 36 // [64]byte, Ed25519 signature of files tags table, at package info
+	TIDkeyid  TID = 37 // [8]byte, identifier of public key to verify signature, at package info
+
+	TIDvariant  TID = 38 // string, full key of primary file, at pre-compressed variant
+	TIDencoding TID = 39 // string, content-coding of pre-compressed variant
+	TIDwhiteout TID = 40 // bool, file is deleted at lower packages of union
+	TIDdellist  TID = 41 // string, keys of deleted files divided by new line, at patch package info
+	TIDdelta    TID = 42 // string, key of base file of binary delta
+	TIDdeltasum TID = 43 // [32]byte, SHA256 of base file content of binary delta
+	TIDdeltalen TID = 44 // uint, size of binary delta before compression
+
 	TIDtmbjpeg  TID = 100 // []byte, thumbnail image (icon) in JPEG format
 	TIDtmbwebp  TID = 101 // []byte, thumbnail image (icon) in WebP format
 	TIDlabel    TID = 110 // string
@@ -259,10 +280,25 @@ const PackName = "@pack"
 type FTT struct {
 	info TagsetRaw                      // special tagset with package tags
 	tsm  util.SeqMap[string, TagsetRaw] // keys - package filenames (case sensitive), values - tagset slices.
+	dirs dirIndex                       // directories tree of package filenames
+	lazy atomic.Pointer[lazyTable]      // table opened in lazy mode, nil if table is loaded
+	dl   delCache                       // parsed list of deleted files from package info
 
 	datoffset uint64 // files data offset
 	datsize   uint64 // files data total size
 
+	comp    CompSelector // compression method selector for new files
+	blk     solidBlock   // solid block under construction
+	dd      dedupState   // content-addressed deduplication state
+	aead    cipher.AEAD  // cipher to encrypt new files, can be nil
+	repro   reproState   // reproducible build settings
+	index   bool         // write index section on sync
+	trailer bool         // write trailer at the end of package on sync
+
+	signer  ed25519.PrivateKey  // key to sign files tags table on sync, can be nil
+	trusted []ed25519.PublicKey // keys to verify signature on open, can be nil
+	badts   func(error)         // reports skipped bad tagsets on open, can be nil
+
 	mux sync.Mutex // writer mutex
 }
 
@@ -270,12 +306,17 @@ type FTT struct {
 func (ftt *FTT) Init(hdr *Header) {
 	ftt.info = nil
 	ftt.tsm.Init(int(hdr.fttcount))
+	ftt.dirs.init()
+	ftt.lazy.Store(nil)
 	// update data offset/pos
 	ftt.datoffset, ftt.datsize = hdr.datoffset, hdr.datsize
 }
 
 // TagsetNum returns actual number of entries at files tags table.
 func (ftt *FTT) TagsetNum() int {
+	if lt := ftt.lazy.Load(); lt != nil {
+		return lt.count
+	}
 	return ftt.tsm.Len()
 }
 
@@ -302,8 +343,17 @@ func (ftt *FTT) SetInfo(ts TagsetRaw) {
 	ftt.info = ts
 }
 
+// SetCompress sets compression method selector for new packing files.
+// Nil selector turns off compression.
+func (ftt *FTT) SetCompress(sel CompSelector) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	ftt.comp = sel
+}
+
 // CheckTagset tests path & offset & size tags existence
-// and checks that size & offset is are in the bounds.
+// and checks that size & offset is are in the bounds,
+// and that file size tag fits to size of stored data.
 func (ftt *FTT) CheckTagset(ts TagsetRaw) (fkey string, err error) {
 	var offset, size uint
 	var ispath, isoffset, issize bool
@@ -352,10 +402,51 @@ func (ftt *FTT) CheckTagset(ts TagsetRaw) (fkey string, err error) {
 		err = &ErrTag{ErrOutSize, fkey, TIDsize}
 		return
 	}
+	if !checkfsize(ts, size) {
+		err = &ErrTag{ErrOutSize, fkey, TIDfsize}
+		return
+	}
 
 	return
 }
 
+// checkfsize checks up that size of file content given by fsize tag
+// fits to size of stored data. Compressed content can not exceed
+// the data size multiplied by maximum compression ratio, content
+// of binary delta is limited by maximum size of delta target,
+// content of encrypted file is equal to plain data size,
+// and content of stored as is file is equal to data size.
+func checkfsize(ts TagsetRaw, size uint) bool {
+	var fsize, ok = ts.TagUint(TIDfsize)
+	if !ok {
+		return true
+	}
+	var plain = int64(size)
+	if alg, _ := ts.TagByte(TIDcipher); alg != CipherNone {
+		if plain = PlainSize(plain, cipheroverhead); plain < 0 {
+			return false
+		}
+	}
+	switch {
+	case ts.Has(TIDdelta):
+		return fsize <= math.MaxInt32
+	case ts.Has(TIDcomp):
+		if method, _ := ts.TagByte(TIDcomp); method != CompNone {
+			return uint64(fsize) <= uint64(plain)*maxcompratio+HeaderSize
+		}
+	}
+	return int64(fsize) == plain
+}
+
+// SetTolerant sets function to report tagsets that does not pass the check
+// on table reading. If it set, such tagsets are skipped, and table is opened
+// with remaining files. Otherwise reading fails on the first bad tagset.
+func (ftt *FTT) SetTolerant(report func(error)) {
+	ftt.mux.Lock()
+	defer ftt.mux.Unlock()
+	ftt.badts = report
+}
+
 // Parse makes table from given byte slice.
 // It's high performance method without extra allocations calls.
 func (ftt *FTT) Parse(buf []byte) (n int64, err error) {
@@ -390,10 +481,17 @@ func (ftt *FTT) Parse(buf []byte) (n int64, err error) {
 
 		var fkey string
 		if fkey, err = ftt.CheckTagset(ts); err != nil {
-			return
+			if ftt.badts == nil {
+				return
+			}
+			ftt.badts(err)
+			err = nil
+			continue
 		}
 
-		ftt.tsm.Poke(util.ToSlash(fkey), ts)
+		fkey = util.ToSlash(fkey)
+		ftt.tsm.Poke(fkey, ts)
+		ftt.dirs.add(fkey)
 	}
 	return
 }
@@ -444,19 +542,31 @@ func (ftt *FTT) ReadFrom(r io.Reader) (n int64, err error) {
 
 		var fkey string
 		if fkey, err = ftt.CheckTagset(ts); err != nil {
-			return
+			if ftt.badts == nil {
+				return
+			}
+			ftt.badts(err)
+			err = nil
+			continue
 		}
 
-		ftt.tsm.Poke(util.ToSlash(fkey), ts)
+		fkey = util.ToSlash(fkey)
+		ftt.tsm.Poke(fkey, ts)
+		ftt.dirs.add(fkey)
 	}
 	return
 }
 
 // WriteTo writes file tags table whole content to the given stream.
 func (ftt *FTT) WriteTo(w io.Writer) (n int64, err error) {
+	return ftt.writeto(w, ftt.info)
+}
+
+// writeto writes file tags table with given package info tagset.
+func (ftt *FTT) writeto(w io.Writer, info TagsetRaw) (n int64, err error) {
 	// write tagset with package info at first, can be empty
 	{
-		var tsl = len(ftt.info)
+		var tsl = len(info)
 		if tsl > tsmaxlen {
 			err = ErrRangeTSSize
 			return
@@ -469,14 +579,14 @@ func (ftt *FTT) WriteTo(w io.Writer) (n int64, err error) {
 		n += PTStssize
 
 		// write tagset content
-		if _, err = w.Write(ftt.info); err != nil {
+		if _, err = w.Write(info); err != nil {
 			return
 		}
 		n += int64(tsl)
 	}
 
 	// write files tags table
-	ftt.tsm.Range(func(fkey string, ts TagsetRaw) bool {
+	ftt.rangeall(func(fkey string, ts TagsetRaw) bool {
 		var tsl = len(ts)
 		if tsl > tsmaxlen {
 			err = ErrRangeTSSize
@@ -510,6 +620,7 @@ func (ftt *FTT) WriteTo(w io.Writer) (n int64, err error) {
 // OpenStream opens package. At first it checkups file signature, then reads
 // records table, and reads file tagset table. Tags set for each file
 // should contain at least file offset, file size, file ID and file name.
+// If trusted keys were set, digital signature of the table is verified.
 func (ftt *FTT) OpenStream(r io.ReadSeeker) (err error) {
 	// go to file start
 	if _, err = r.Seek(0, io.SeekStart); err != nil {
@@ -547,6 +658,10 @@ func (ftt *FTT) OpenStream(r io.ReadSeeker) (err error) {
 		err = ErrSignFTT
 		return
 	}
+	// check up digital signature if trusted keys are set
+	if ftt.trusted != nil {
+		err = ftt.VerifySign(ftt.trusted...)
+	}
 	return
 }
 
@@ -564,6 +679,13 @@ func (ftt *FTT) OpenFile(fpath string) (err error) {
 	return
 }
 
+// OpenReaderAt opens package placed at random-access source with given size,
+// it calls `OpenStream` method with section reader of the source. Source can be
+// file embedded by embed.FS, blob in memory, or section of a larger file.
+func (ftt *FTT) OpenReaderAt(r io.ReaderAt, size int64) error {
+	return ftt.OpenStream(io.NewSectionReader(r, 0, size))
+}
+
 // Package structure contains file tags table, tagger object
 // to get access to nested files, and subdirectory workspace.
 type Package struct {
@@ -617,70 +739,109 @@ func (pkg *Package) BaseTagset(offset, size uint, fkey string) TagsetRaw {
 
 // HasTagset check up that tagset with given filename key is present.
 func (pkg *Package) HasTagset(fkey string) bool {
-	return pkg.tsm.Has(pkg.FullPath(util.ToSlash(fkey)))
+	var _, ok = pkg.peek(pkg.FullPath(util.ToSlash(fkey)))
+	return ok
 }
 
 // GetTagset returns tagset with given filename key, if it found.
+// File placed into solid block under construction is reported as absent
+// until the block will be written, its content can not be read before.
 func (pkg *Package) GetTagset(fkey string) (TagsetRaw, bool) {
-	return pkg.tsm.Peek(pkg.FullPath(util.ToSlash(fkey)))
+	var ts, ok = pkg.PeekTagset(fkey)
+	if ok && unflushed(ts) {
+		return nil, false
+	}
+	return ts, ok
+}
+
+// PeekTagset returns tagset with given filename key including file placed
+// into solid block under construction. Tags of such file can be modified,
+// but its content can not be read until the block will be written.
+func (pkg *Package) PeekTagset(fkey string) (TagsetRaw, bool) {
+	return pkg.peek(pkg.FullPath(util.ToSlash(fkey)))
 }
 
 // SetTagset puts tagset with given filename key.
-func (pkg *Package) SetTagset(fkey string, ts TagsetRaw) {
-	pkg.tsm.Poke(pkg.FullPath(util.ToSlash(fkey)), ts)
+// Lazy table is loaded before modification, and tagset
+// is not put if the table can not be loaded.
+func (pkg *Package) SetTagset(fkey string, ts TagsetRaw) (err error) {
+	if err = pkg.Load(); err != nil {
+		return
+	}
+	fkey = pkg.FullPath(util.ToSlash(fkey))
+	pkg.tsm.Poke(fkey, ts)
+	pkg.dirs.add(fkey)
+	return
 }
 
 // SetupTagset puts tagset with filename key stored at tagset.
-func (pkg *Package) SetupTagset(ts TagsetRaw) {
-	pkg.tsm.Poke(ts.Path(), ts)
+// Lazy table is loaded before modification, and tagset
+// is not put if the table can not be loaded.
+func (pkg *Package) SetupTagset(ts TagsetRaw) (err error) {
+	if err = pkg.Load(); err != nil {
+		return
+	}
+	var fkey = ts.Path()
+	pkg.tsm.Poke(fkey, ts)
+	pkg.dirs.add(fkey)
+	return
 }
 
-// GetDelTagset deletes the tagset for a key, returning the previous tagset if any.
-func (pkg *Package) DelTagset(fkey string) (TagsetRaw, bool) {
-	return pkg.tsm.Delete(pkg.FullPath(util.ToSlash(fkey)))
+// DelTagset deletes the tagset for a key, returning the previous tagset if any.
+// Lazy table is loaded before modification, and nothing is deleted
+// if the table can not be loaded.
+func (pkg *Package) DelTagset(fkey string) (ts TagsetRaw, ok bool) {
+	if pkg.Load() != nil {
+		return
+	}
+	fkey = pkg.FullPath(util.ToSlash(fkey))
+	if ts, ok = pkg.tsm.Delete(fkey); ok {
+		pkg.dirs.del(fkey)
+	}
+	return
 }
 
 // Enum calls given closure for each tagset in package. Skips package info.
+// Tagsets are enumerated in order they were placed for package without
+// workspace, and in order of directories tree for package with workspace.
 func (pkg *Package) Enum(f func(string, TagsetRaw) bool) {
-	var prefix string
-	if pkg.Workspace != "." && pkg.Workspace != "" {
-		prefix = pkg.Workspace + "/" // make prefix path slash-terminated
+	if pkg.Workspace == "." || pkg.Workspace == "" {
+		pkg.rangeall(f)
+		return
+	}
+	var prefix = pkg.Workspace + "/" // make prefix path slash-terminated
+	for _, fkey := range pkg.dirindex().walk(pkg.Workspace) {
+		if ts, ok := pkg.peek(fkey); ok && !f(fkey[len(prefix):], ts) {
+			return
+		}
 	}
-	pkg.tsm.Range(func(fkey string, ts TagsetRaw) bool {
-		return !strings.HasPrefix(fkey, prefix) || f(fkey[len(prefix):], ts)
-	})
 }
 
 // Sub clones object and gives access to pointed subdirectory.
 // fs.SubFS implementation.
 func (pkg *Package) Sub(dir string) (sub fs.FS, err error) {
-	var prefix string
-	if dir != "." && dir != "" {
-		prefix = util.ToSlash(dir) + "/" // make prefix slash-terminated
-	}
-	pkg.Enum(func(fkey string, ts TagsetRaw) bool {
-		if strings.HasPrefix(fkey, prefix) {
-			sub = &Package{
-				FTT:       pkg.FTT,
-				Tagger:    pkg.Tagger,
-				Workspace: pkg.FullPath(util.ToSlash(dir)),
-			}
-			return false
-		}
-		return true
-	})
-	if sub == nil { // on case if not found
+	var fulldir = pkg.FullPath(util.ToSlash(dir))
+	if !pkg.dirindex().has(fulldir) { // on case if not found
 		err = &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrNotExist}
+		return
+	}
+	sub = &Package{
+		FTT:       pkg.FTT,
+		Tagger:    pkg.Tagger,
+		Workspace: fulldir,
 	}
 	return
 }
 
-// Stat returns a fs.FileInfo describing the file.
+// Stat returns a fs.FileInfo describing the file or directory.
 // fs.StatFS interface implementation.
 func (pkg *Package) Stat(fkey string) (fs.FileInfo, error) {
 	if ts, is := pkg.GetTagset(fkey); is {
 		return ts, nil
 	}
+	if f, err := pkg.OpenDir(pkg.FullPath(util.ToSlash(fkey))); err == nil {
+		return f.Stat()
+	}
 	return nil, &fs.PathError{Op: "stat", Path: fkey, Err: fs.ErrNotExist}
 }
 
@@ -713,6 +874,9 @@ func (pkg *Package) ReadDir(dir string) ([]fs.DirEntry, error) {
 // Makes content copy to prevent ambiguous access to closed mapped memory block.
 // fs.ReadFileFS implementation.
 func (pkg *Package) ReadFile(fkey string) ([]byte, error) {
+	if !validpath(fkey) {
+		return nil, &fs.PathError{Op: "readfile", Path: fkey, Err: fs.ErrInvalid}
+	}
 	if ts, is := pkg.GetTagset(fkey); is {
 		var f, err = pkg.Tagger.OpenTagset(ts)
 		if err != nil {
@@ -722,7 +886,7 @@ func (pkg *Package) ReadFile(fkey string) ([]byte, error) {
 
 		var size = ts.Size()
 		var buf = make([]byte, size)
-		_, err = f.Read(buf)
+		_, err = io.ReadFull(f, buf)
 		return buf, err
 	}
 	return nil, &fs.PathError{Op: "readfile", Path: fkey, Err: fs.ErrNotExist}
@@ -731,6 +895,9 @@ func (pkg *Package) ReadFile(fkey string) ([]byte, error) {
 // Open implements access to nested into package file or directory by filename.
 // fs.FS implementation.
 func (pkg *Package) Open(dir string) (fs.File, error) {
+	if !validpath(dir) {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrInvalid}
+	}
 	var fullname = pkg.FullPath(dir)
 	if fullname == PackName {
 		var ts = pkg.BaseTagset(0, uint(pkg.datoffset+pkg.datsize), "wpk")
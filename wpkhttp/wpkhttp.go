@@ -0,0 +1,184 @@
+package wpkhttp
+
+import (
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schwarzlichtbezirk/wpk"
+)
+
+// IndexName is file name served for requests to directory.
+const IndexName = "index.html"
+
+// DefEncodings is default list of content-codings
+// of pre-compressed variants in order of preference.
+var DefEncodings = []string{"br", "gzip"}
+
+// Handler serves nested files of packages by HTTP. It sets Content-Type
+// from MIME tag, ETag from the strongest hash tag, Last-Modified from
+// modification time tag, and handles Range and conditional requests.
+// http.Handler interface implementation.
+type Handler struct {
+	Union     *wpk.Union // packages to look up files, first found file is served
+	Encodings []string   // content-codings of pre-compressed variants in order of preference
+}
+
+// NewHandler returns handler to serve files of given package.
+func NewHandler(pkg *wpk.Package) *Handler {
+	return &Handler{
+		Union:     &wpk.Union{List: []*wpk.Package{pkg}},
+		Encodings: DefEncodings,
+	}
+}
+
+// NewUnionHandler returns handler to serve files of given union of packages.
+// Files are looked up in the same way as union does, with whiteout entries
+// and lists of deleted files if union honours them. Note that it replaces
+// taggers of union packages by wpk.DeltaTagger decorators with union.WrapDelta,
+// so files packed as binary deltas are served with content reconstructed
+// from base files.
+func NewUnionHandler(u *wpk.Union) *Handler {
+	u.WrapDelta()
+	return &Handler{
+		Union:     u,
+		Encodings: DefEncodings,
+	}
+}
+
+// ServeHTTP serves file with key given by URL path.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var upath = r.URL.Path
+	var fkey = strings.TrimPrefix(path.Clean("/"+upath), "/")
+	if strings.HasSuffix(upath, "/") {
+		fkey = path.Join(fkey, IndexName)
+	}
+	var pkg, ts, ok = h.Union.Lookup(fkey)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var hdr = w.Header()
+	var ctype, _ = ts.TagStr(wpk.TIDmime)
+	if ctype == "" {
+		ctype = mime.TypeByExtension(path.Ext(fkey))
+	}
+	if ctype != "" {
+		hdr.Set("Content-Type", ctype)
+	}
+
+	// select pre-compressed variant
+	if _, enc, _ := pkg.GetVariant(fkey, h.Encodings); enc != "" {
+		hdr.Add("Vary", "Accept-Encoding")
+		var ae = r.Header.Get("Accept-Encoding")
+		var accept []string
+		for _, enc := range h.Encodings {
+			if AcceptEncoding(ae, enc) {
+				accept = append(accept, enc)
+			}
+		}
+		if ts, enc, _ = pkg.GetVariant(fkey, accept); enc != "" {
+			hdr.Set("Content-Encoding", enc)
+		}
+	}
+
+	var modtime = ts.ModTime()
+	if etag := ETag(ts); etag != "" {
+		hdr.Set("ETag", etag)
+	}
+	if notModified(r, hdr.Get("ETag"), modtime) {
+		delete(hdr, "Content-Type")
+		delete(hdr, "Content-Encoding")
+		if !modtime.IsZero() {
+			hdr.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var f, err = pkg.Tagger.OpenTagset(ts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	http.ServeContent(w, r, path.Base(fkey), modtime, f)
+}
+
+// ETag returns entity tag made from the strongest hash tag present
+// at given tagset, or empty string if there is no any hash tag.
+// Entity tag is strong for MD5 and SHA digests, and weak for CRC
+// checksums, that can collide for different content.
+func ETag(ts wpk.TagsetRaw) string {
+	for i := len(wpk.HashTIDs) - 1; i >= 0; i-- {
+		var tid = wpk.HashTIDs[i]
+		if tag, ok := ts.Get(tid); ok {
+			var etag = `"` + hex.EncodeToString(tag) + `"`
+			if !wpk.IsDigestTID(tid) {
+				etag = "W/" + etag
+			}
+			return etag
+		}
+	}
+	return ""
+}
+
+// AcceptEncoding checks up that content-coding with given name
+// is acceptable by value of Accept-Encoding header.
+func AcceptEncoding(header, name string) bool {
+	for _, part := range strings.Split(header, ",") {
+		var coding, params, _ = strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, name) && coding != "*" {
+			continue
+		}
+		params = strings.TrimSpace(params)
+		if q, ok := strings.CutPrefix(params, "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// notModified checks up conditional request headers before the file
+// is opened. Requests with If-Match or If-Unmodified-Since headers are
+// left to http.ServeContent.
+func notModified(r *http.Request, etag string, modtime time.Time) bool {
+	if r.Header.Get("If-Match") != "" || r.Header.Get("If-Unmodified-Since") != "" {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, v := range strings.Split(inm, ",") {
+			v = strings.TrimSpace(v)
+			if v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modtime.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !modtime.Truncate(time.Second).After(t)
+		}
+	}
+	return false
+}
+
+// The End.
@@ -0,0 +1,149 @@
+package wpkhttp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/schwarzlichtbezirk/wpk"
+	"github.com/schwarzlichtbezirk/wpk/bulk"
+	"github.com/schwarzlichtbezirk/wpk/wpkhttp"
+)
+
+var testpack = wpk.TempPath("testhttp.wpk")
+
+var content = []byte(`body { color: black; background: white; }`)
+
+// Test HTTP handler headers, conditional, range and pre-compressed requests.
+func TestHandler(t *testing.T) {
+	var err error
+	var fwpk *os.File
+	var pkg = wpk.NewPackage()
+
+	defer os.Remove(testpack)
+
+	var putdata = func(name string, data []byte, mime string) {
+		var ts wpk.TagsetRaw
+		if ts, err = pkg.PackData(fwpk, bytes.NewReader(data), name); err != nil {
+			t.Fatal(err)
+		}
+		var h = wpk.NewTagHash(wpk.TIDsha256, nil)
+		h.Write(data)
+		ts = ts.Put(wpk.TIDsha256, h.Sum(nil)).
+			Put(wpk.TIDmtime, wpk.TimeTag(time.Now()))
+		if mime != "" {
+			ts = ts.Put(wpk.TIDmime, wpk.StrTag(mime))
+		}
+		pkg.SetTagset(name, ts)
+	}
+
+	if fwpk, err = os.OpenFile(testpack, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fwpk.Close()
+	if err = pkg.Begin(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	var zw = gzip.NewWriter(&gz)
+	zw.Write(content)
+	zw.Close()
+	putdata("css/main.css", content, "text/css; charset=utf-8")
+	putdata("css/main.css.gz", gz.Bytes(), "")
+	if !pkg.LinkVariant("css/main.css", "gzip") {
+		t.Fatal("variant is not linked")
+	}
+	putdata("index.html", []byte("<html></html>"), "")
+	if err = pkg.Sync(fwpk, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if pkg.Tagger, err = bulk.MakeTagger(testpack); err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.Close()
+
+	var h = wpkhttp.NewHandler(pkg)
+	var get = func(url string, hdr map[string]string) *http.Response {
+		var r = httptest.NewRequest(http.MethodGet, url, nil)
+		for k, v := range hdr {
+			r.Header.Set(k, v)
+		}
+		var w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	// plain request
+	var resp = get("/css/main.css", nil)
+	var body, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, content) {
+		t.Fatalf("wrong response with status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/css; charset=utf-8" {
+		t.Fatalf("wrong content type '%s'", ct)
+	}
+	var ts, _ = pkg.GetTagset("css/main.css")
+	var etag = resp.Header.Get("ETag")
+	if etag == "" || etag != wpkhttp.ETag(ts) {
+		t.Fatalf("wrong entity tag '%s'", etag)
+	}
+	if resp.Header.Get("Last-Modified") == "" {
+		t.Fatal("last modified time is absent")
+	}
+	if resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatal("vary header is absent for file with variants")
+	}
+
+	// conditional request
+	if resp = get("/css/main.css", map[string]string{"If-None-Match": etag}); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected not modified status, got %d", resp.StatusCode)
+	}
+	if resp = get("/css/main.css", map[string]string{"If-None-Match": `"other"`}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected ok status, got %d", resp.StatusCode)
+	}
+
+	// range request
+	resp = get("/css/main.css", map[string]string{"Range": "bytes=7-11"})
+	body, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(body, content[7:12]) {
+		t.Fatalf("wrong partial content with status %d", resp.StatusCode)
+	}
+
+	// pre-compressed variant
+	resp = get("/css/main.css", map[string]string{"Accept-Encoding": "br;q=0, gzip"})
+	body, _ = io.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Encoding") != "gzip" || !bytes.Equal(body, gz.Bytes()) {
+		t.Fatal("pre-compressed variant is not served")
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/css; charset=utf-8" {
+		t.Fatalf("wrong content type of variant '%s'", ct)
+	}
+	if resp.Header.Get("ETag") == etag {
+		t.Fatal("variant should have its own entity tag")
+	}
+
+	// directory index, and absent file
+	if resp = get("/", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("index is not served, status %d", resp.StatusCode)
+	}
+	if resp = get("/css/absent.css", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected not found status, got %d", resp.StatusCode)
+	}
+
+	// entity tag made from checksum is weak
+	var crc = wpk.TagsetRaw{}.Put(wpk.TIDcrc32c, []byte{1, 2, 3, 4})
+	if etag = wpkhttp.ETag(crc); etag != `W/"01020304"` {
+		t.Fatalf("expected weak entity tag, got '%s'", etag)
+	}
+	if etag = wpkhttp.ETag(crc.Put(wpk.TIDmd5, make([]byte, 16))); etag[0] != '"' {
+		t.Fatalf("expected strong entity tag, got '%s'", etag)
+	}
+}
+
+// The End.
@@ -1,13 +1,13 @@
 package wpk
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"io"
 	"io/fs"
 	"os"
 	"strings"
 
-	"gopkg.in/djherbis/times.v1"
-
 	"github.com/schwarzlichtbezirk/wpk/util"
 )
 
@@ -23,6 +23,10 @@ func (ftt *FTT) Begin(wpt, wpf io.WriteSeeker) (err error) {
 	ftt.mux.Lock()
 	defer ftt.mux.Unlock()
 
+	// load table opened in lazy mode
+	if err = ftt.Load(); err != nil {
+		return
+	}
 	// write prebuild header
 	var offset uint64
 	if wpf == nil || wpf == wpt {
@@ -44,6 +48,12 @@ func (ftt *FTT) Begin(wpt, wpf io.WriteSeeker) (err error) {
 	}
 	// update data offset/pos
 	ftt.datoffset, ftt.datsize = hdr.datoffset, hdr.datsize
+	// drop unfinished solid block
+	ftt.blk.buf, ftt.blk.keys = nil, nil
+	// forget content of previous package
+	if ftt.dd.hashes != nil {
+		ftt.dd.hashes = map[[sha256.Size]byte]dedupRef{}
+	}
 	return
 }
 
@@ -52,6 +62,10 @@ func (ftt *FTT) Append(wpt, wpf io.WriteSeeker) (err error) {
 	ftt.mux.Lock()
 	defer ftt.mux.Unlock()
 
+	// load table opened in lazy mode
+	if err = ftt.Load(); err != nil {
+		return
+	}
 	// go to file start
 	if _, err = wpt.Seek(0, io.SeekStart); err != nil {
 		return
@@ -60,6 +74,8 @@ func (ftt *FTT) Append(wpt, wpf io.WriteSeeker) (err error) {
 	if _, err = wpt.Write(util.S2B(SignBuild)); err != nil {
 		return
 	}
+	// continue solid blocks numbering
+	ftt.blk.id = ftt.lastblock()
 	// go to tags table start to replace it by new data
 	if wpf != nil && wpf != wpt { // splitted package files
 		if _, err = wpf.Seek(int64(ftt.datoffset+ftt.datsize), io.SeekStart); err != nil {
@@ -74,12 +90,35 @@ func (ftt *FTT) Append(wpt, wpf io.WriteSeeker) (err error) {
 }
 
 // Sync writes actual file tags table and true signature with settings.
+// If signer key was set, files tags table is signed by Ed25519.
+// If index was turned on, index section is written after the table.
+// If trailer was turned on, single file package is ended by trailer.
 func (ftt *FTT) Sync(wpt, wpf io.WriteSeeker) (err error) {
 	ftt.mux.Lock()
 	defer ftt.mux.Unlock()
 
 	var fftpos, fftend, datpos, datend int64
 
+	// load table opened in lazy mode
+	if err = ftt.Load(); err != nil {
+		return
+	}
+	// write unfinished solid block
+	if wpf != nil && wpf != wpt {
+		err = ftt.flushblock(wpf)
+	} else {
+		err = ftt.flushblock(wpt)
+	}
+	if err != nil {
+		return
+	}
+	// canonical order of files tags table
+	ftt.sortkeys()
+	// sign files tags table
+	if err = ftt.sign(); err != nil {
+		return
+	}
+
 	if wpf != nil && wpf != wpt { // splitted package files
 		// get tags table offset as actual end of file
 		datpos = 0
@@ -99,6 +138,12 @@ func (ftt *FTT) Sync(wpt, wpf io.WriteSeeker) (err error) {
 		if fftend, err = wpt.Seek(0, io.SeekCurrent); err != nil {
 			return
 		}
+		// write index section after files tags table
+		if ftt.index {
+			if err = ftt.writeindex(wpt); err != nil {
+				return
+			}
+		}
 	} else { // single package file
 		// get tags table offset as actual end of file
 		datpos = HeaderSize
@@ -115,6 +160,18 @@ func (ftt *FTT) Sync(wpt, wpf io.WriteSeeker) (err error) {
 		if fftend, err = wpt.Seek(0, io.SeekCurrent); err != nil {
 			return
 		}
+		// write index section after files tags table
+		if ftt.index {
+			if err = ftt.writeindex(wpt); err != nil {
+				return
+			}
+		}
+		// write trailer at the end of package
+		if ftt.trailer {
+			if err = writetrailer(wpt); err != nil {
+				return
+			}
+		}
 	}
 
 	// rewrite true header
@@ -138,34 +195,122 @@ func (ftt *FTT) Sync(wpt, wpf io.WriteSeeker) (err error) {
 }
 
 // PackData puts data streamed by given reader into package as a file
-// and associate keyname "fkey" with it.
+// and associate keyname "fkey" with it. Data is compressed by the method
+// given by compression selector, if it was set, and then encrypted if cipher
+// key was set. In dedup mode file with already packed content refers to
+// existing data. In solid mode small file is placed into solid block, and
+// its tagset has zero size and offset of block start until the block will
+// be written by next block start or by Sync. Such file is reported as absent
+// by GetTagset before that, since its content can not be read yet.
 func (pkg *Package) PackData(w io.WriteSeeker, r io.Reader, fkey string) (ts TagsetRaw, err error) {
-	if _, ok := pkg.GetTagset(fkey); ok {
+	return pkg.packdata(w, r, fkey, nil)
+}
+
+// packdata is PackData implementation. If prepared content is given,
+// it's used instead of the reader, and its compressed data is written
+// instead of compression on the fly.
+func (pkg *Package) packdata(w io.WriteSeeker, r io.Reader, fkey string, pre *prepared) (ts TagsetRaw, err error) {
+	if _, ok := pkg.PeekTagset(fkey); ok {
 		err = &fs.PathError{Op: "packdata", Path: fkey, Err: fs.ErrExist}
 		return
 	}
 
-	var offset, size int64
+	var offset, size, fsize int64
+	var method = CompNone
+	var sw *SealWriter
+	var sum [sha256.Size]byte
 	if func() {
 		pkg.mux.Lock()
 		defer pkg.mux.Unlock()
 
+		if pre != nil {
+			method, sum, r = pre.method, pre.sum, bytes.NewReader(pre.data)
+		} else if pkg.comp != nil {
+			method = pkg.comp(fkey)
+		}
+		// refer to identical content that was already packed
+		if pkg.dd.hashes != nil {
+			if pre == nil {
+				if sum, r, err = dedupdigest(r); err != nil {
+					return
+				}
+			}
+			if orig, ok := pkg.dedupfind(sum); ok {
+				ts = pkg.dedupts(orig, fkey)
+				pkg.SetTagset(fkey, ts)
+				return
+			}
+		}
+		// put small file into solid block
+		if pkg.blk.blksize > 0 {
+			var head = make([]byte, pkg.blk.maxsize+1)
+			var n int
+			if n, err = io.ReadFull(r, head); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+				return
+			}
+			err = nil
+			if n > 0 && n <= pkg.blk.maxsize {
+				if ts, err = pkg.putblock(w, head[:n], fkey); err == nil && pkg.dd.hashes != nil {
+					pkg.dd.hashes[sum] = makeref(ts)
+				}
+				return
+			}
+			// file is too big for solid block, so block should be finished,
+			// empty file is written as is
+			if n > pkg.blk.maxsize {
+				if err = pkg.flushblock(w); err != nil {
+					return
+				}
+			}
+			r = io.MultiReader(bytes.NewReader(head[:n]), r)
+		}
 		// get offset and put provided data
 		if offset, err = w.Seek(0, io.SeekCurrent); err != nil {
 			return
 		}
-		if size, err = io.Copy(w, r); err != nil {
+		var cw = countWriter{w: w}
+		var dst io.Writer = &cw
+		if pkg.aead != nil {
+			if sw, err = NewSealWriter(&cw, pkg.aead); err != nil {
+				return
+			}
+			dst = sw
+		}
+		if pre != nil && method != CompNone {
+			if _, err = dst.Write(pre.comp); err != nil {
+				return
+			}
+			fsize = int64(len(pre.data))
+		} else if _, fsize, err = CompressTo(dst, r, method); err != nil {
 			return
 		}
+		if sw != nil {
+			if err = sw.Close(); err != nil {
+				return
+			}
+		}
+		size = cw.n
 		// update actual package data size
 		pkg.datsize += uint64(size)
-	}(); err != nil {
+	}(); err != nil || ts != nil {
 		return
 	}
 
 	// insert new entry to tags table
 	ts = pkg.BaseTagset(uint(offset), uint(size), fkey)
+	if method != CompNone {
+		ts = ts.Put(TIDcomp, ByteTag(method))
+	}
+	if sw != nil {
+		ts = ts.
+			Put(TIDcipher, ByteTag(CipherAESGCM)).
+			Put(TIDnonce, sw.Nonce())
+	}
+	if method != CompNone || sw != nil {
+		ts = ts.Put(TIDfsize, UintTag(uint(fsize)))
+	}
 	pkg.SetTagset(fkey, ts)
+	pkg.dedupput(sum, ts)
 	return
 }
 
@@ -179,16 +324,10 @@ func (pkg *Package) PackFile(w io.WriteSeeker, file fs.File, fkey string) (ts Ta
 		return
 	}
 
-	//ts = ts.Put(TIDmtime, TimeTag(fi.ModTime()))
-	var tsp = times.Get(fi)
-	ts = ts.Put(TIDmtime, TimeTag(tsp.ModTime()))
-	ts = ts.Put(TIDatime, TimeTag(tsp.AccessTime()))
-	if tsp.HasChangeTime() {
-		ts = ts.Put(TIDctime, TimeTag(tsp.ChangeTime()))
-	}
-	if tsp.HasBirthTime() {
-		ts = ts.Put(TIDbtime, TimeTag(tsp.BirthTime()))
-	}
+	pkg.mux.Lock()
+	var repro = pkg.repro
+	pkg.mux.Unlock()
+	ts = repro.puttimes(ts, fi)
 	pkg.SetTagset(fkey, ts)
 	return
 }
@@ -196,7 +335,7 @@ func (pkg *Package) PackFile(w io.WriteSeeker, file fs.File, fkey string) (ts Ta
 // Rename tagset with file name 'fkey1' to 'fkey2'.
 // Keeps link to original file name.
 func (pkg *Package) Rename(fkey1, fkey2 string) error {
-	var ts, ok = pkg.GetTagset(fkey1)
+	var ts, ok = pkg.PeekTagset(fkey1)
 	if !ok {
 		return &fs.PathError{Op: "rename", Path: fkey1, Err: fs.ErrNotExist}
 	}
@@ -207,6 +346,7 @@ func (pkg *Package) Rename(fkey1, fkey2 string) error {
 	ts = CopyTagset(ts).Set(TIDpath, StrTag(pkg.FullPath(util.ToSlash(fkey2))))
 	pkg.DelTagset(fkey1)
 	pkg.SetTagset(fkey2, ts)
+	pkg.trackblock(ts)
 	return nil
 }
 
@@ -221,13 +361,14 @@ func (pkg *Package) RenameDir(olddir, newdir string, skipexist bool) (count int,
 	pkg.Enum(func(fkey string, ts TagsetRaw) bool {
 		if strings.HasPrefix(fkey, olddir) {
 			var newkey = newdir + fkey[len(olddir):]
-			if _, ok := pkg.GetTagset(newkey); ok {
+			if _, ok := pkg.PeekTagset(newkey); ok {
 				err = &fs.PathError{Op: "renamedir", Path: newkey, Err: fs.ErrExist}
 				return skipexist
 			}
 			ts = CopyTagset(ts).Set(TIDpath, StrTag(pkg.FullPath(util.ToSlash(newkey))))
 			pkg.DelTagset(fkey)
 			pkg.SetTagset(newkey, ts)
+			pkg.trackblock(ts)
 			count++
 		}
 		return true
@@ -241,16 +382,17 @@ func (pkg *Package) RenameDir(olddir, newdir string, skipexist bool) (count int,
 // PutAlias makes clone tagset with file name 'fkey1' and replace name tag
 // in it to 'fkey2'. Keeps link to original file name.
 func (pkg *Package) PutAlias(fkey1, fkey2 string) error {
-	var ts, ok = pkg.GetTagset(fkey1)
+	var ts, ok = pkg.PeekTagset(fkey1)
 	if !ok {
 		return &fs.PathError{Op: "putalias", Path: fkey1, Err: fs.ErrNotExist}
 	}
-	if _, ok = pkg.GetTagset(fkey2); ok {
+	if _, ok = pkg.PeekTagset(fkey2); ok {
 		return &fs.PathError{Op: "putalias", Path: fkey2, Err: fs.ErrExist}
 	}
 
 	ts = CopyTagset(ts).Set(TIDpath, StrTag(pkg.FullPath(util.ToSlash(fkey2))))
 	pkg.SetTagset(fkey2, ts)
+	pkg.trackblock(ts)
 	return nil
 }
 